@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,10 +25,20 @@ func main() {
 
 	store := services.NewPostgresQRCodeStore(db)
 	qrService := services.NewQRService(store)
+	// deleted codes stay in the trash for QR_TRASH_RETENTION_DAYS
+	qrService.StartTrashPurge()
 	qrHandler := handlers.NewQRHandler(qrService)
 
 	r := gin.Default()
 
+	// the scanner's address comes from nginx's X-Real-IP, only when the request was
+	// sent by one of TRUSTED_PROXIES. anyone else could pick their own address and
+	// get around the per-address unlock limit
+	r.RemoteIPHeaders = []string{"X-Real-IP"}
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -44,14 +55,36 @@ func main() {
 	qr := r.Group("/v1/qr")
 	{
 		qr.POST("", qrHandler.CreateQRCode)
+		qr.POST("/decode", qrHandler.DecodeQRCode)
+		qr.POST("/sheet", qrHandler.CreateSheet)
 		qr.GET("/:id", qrHandler.GetQRCode)
+		qr.PATCH("/:id", qrHandler.UpdateQRCode)
+		qr.POST("/:id/pause", qrHandler.PauseQRCode)
+		qr.POST("/:id/resume", qrHandler.ResumeQRCode)
+		qr.POST("/:id/archive", qrHandler.ArchiveQRCode)
 		qr.DELETE("/:id", qrHandler.DeleteQRCode)
+		qr.GET("/trash", qrHandler.ListTrash)
+		qr.POST("/:id/restore", qrHandler.RestoreQRCode)
 		qr.GET("", qrHandler.GetQRCodeByURL)
 		qr.GET("/:id/scans", qrHandler.GetScanCount)
+		qr.GET("/:id/history", qrHandler.GetDestinationHistory)
+		qr.GET("/:id/image", qrHandler.GetQRCodeImage)
+	}
+
+	// logo endpoints, logos are uploaded once and referenced by logo_id
+	logos := r.Group("/v1/logos")
+	{
+		logos.POST("", qrHandler.UploadLogo)
+		logos.GET("/:id", qrHandler.GetLogo)
 	}
 
+	// fonts and frame templates available when creating a code
+	r.GET("/v1/fonts", qrHandler.ListFonts)
+	r.GET("/v1/frames", qrHandler.ListFrames)
+
 	// redirect endpoint for QR code scans
 	r.GET("/r/:id", qrHandler.HandleRedirect)
+	r.POST("/r/:id", qrHandler.UnlockQRCode)
 
 	port := os.Getenv("PORT")
 
@@ -60,3 +93,14 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// comma separated addresses or CIDR ranges from TRUSTED_PROXIES, none when unset
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
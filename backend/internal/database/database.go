@@ -68,20 +68,90 @@ func InitDB() (*sql.DB, error) {
 	return db, nil
 }
 
-func createTables(db *sql.DB) error {
-	createTableQuery := `
+var tables = []string{
+	`
 	CREATE TABLE IF NOT EXISTS qr_codes (
 		id VARCHAR(255) PRIMARY KEY,
 		url TEXT NOT NULL,
 		created_at TIMESTAMP NOT NULL,
 		expires_at TIMESTAMP,
-		image_base64 TEXT,
-		scan_count INTEGER DEFAULT 0
-	);`
+		scan_count INTEGER DEFAULT 0,
+		render_options JSONB NOT NULL DEFAULT '{}',
+		redirect_rules JSONB NOT NULL DEFAULT '[]',
+		schedule JSONB NOT NULL DEFAULT '{}',
+		split JSONB NOT NULL DEFAULT '{}',
+		tracking JSONB NOT NULL DEFAULT '{}',
+		password_hash TEXT NOT NULL DEFAULT '',
+		unlock_count INTEGER NOT NULL DEFAULT 0,
+		max_scans INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'active',
+		deleted_at TIMESTAMP
+	);`,
+	`
+	CREATE TABLE IF NOT EXISTS logos (
+		id VARCHAR(64) PRIMARY KEY,
+		content_type VARCHAR(255) NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		data BYTEA NOT NULL
+	);`,
+	`
+	CREATE TABLE IF NOT EXISTS qr_destination_history (
+		id BIGSERIAL PRIMARY KEY,
+		qr_code_id VARCHAR(255) NOT NULL REFERENCES qr_codes(id) ON DELETE CASCADE,
+		old_url TEXT NOT NULL,
+		new_url TEXT NOT NULL,
+		old_expires_at TIMESTAMP,
+		new_expires_at TIMESTAMP,
+		changed_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS qr_destination_history_qr_code_id ON qr_destination_history (qr_code_id, changed_at);`,
+	`
+	CREATE TABLE IF NOT EXISTS qr_variant_scans (
+		qr_code_id VARCHAR(255) NOT NULL REFERENCES qr_codes(id) ON DELETE CASCADE,
+		variant VARCHAR(32) NOT NULL,
+		scan_count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (qr_code_id, variant)
+	);`,
+}
 
-	_, err := db.Exec(createTableQuery)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %v", err)
+func createTables(db *sql.DB) error {
+	for _, createTableQuery := range tables {
+		if _, err := db.Exec(createTableQuery); err != nil {
+			return fmt.Errorf("failed to create table: %v", err)
+		}
+	}
+
+	if err := migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate table: %v", err)
+	}
+	return nil
+}
+
+// migrations for tables created by older versions, each one must be safe to re-run
+var migrations = []string{
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS render_options JSONB NOT NULL DEFAULT '{}'`,
+	// images are rendered on demand from render_options
+	`ALTER TABLE qr_codes DROP COLUMN IF EXISTS image_base64`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS redirect_rules JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS schedule JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS split JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS tracking JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS unlock_count INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS max_scans INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'`,
+	`ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+	// the purge only looks at trashed codes
+	`CREATE INDEX IF NOT EXISTS qr_codes_deleted_at ON qr_codes (deleted_at) WHERE deleted_at IS NOT NULL`,
+}
+
+func migrate(db *sql.DB) error {
+	for _, query := range migrations {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
 	}
 	return nil
 }
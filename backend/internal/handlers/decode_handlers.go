@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// room for the multipart headers and boundaries around the image
+const decodeFormOverhead = 64 << 10
+
+// decode the qr codes in a photo or scan uploaded as the "image" field of a multipart form
+func (h *QRHandler) DecodeQRCode(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxDecodeBytes+decodeFormOverhead)
+	file, err := c.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("image must be at most %d bytes", services.MaxDecodeBytes)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	// read one byte past the limit so the service can reject oversized images
+	data, err := io.ReadAll(io.LimitReader(f, services.MaxDecodeBytes+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	symbols, err := h.qrService.DecodeImage(data)
+	if err != nil {
+		var verr *services.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"symbols": symbols})
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -34,6 +38,15 @@ func (h *QRHandler) CreateQRCode(c *gin.Context) {
 
 	qr, err := h.qrService.GenerateQRCode(&req)
 	if err != nil {
+		var verr *services.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrIDTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -68,6 +81,112 @@ func (h *QRHandler) GetQRCode(c *gin.Context) {
 	c.JSON(http.StatusOK, qr)
 }
 
+// get the raw qr code image. the format comes from ?format=, then the Accept header,
+// then the format the code was created with
+func (h *QRHandler) GetQRCodeImage(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code ID is required"})
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = formatFromAccept(c.GetHeader("Accept"))
+	}
+
+	size := 0
+	if v := c.Query("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be a number"})
+			return
+		}
+		size = n
+	}
+
+	img, format, err := h.qrService.RenderImage(id, format, size)
+	if err != nil {
+		var verr *services.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "QR code not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sum := sha256.Sum256(img)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("Vary", "Accept")
+
+	if c.Query("download") == "1" {
+		filename := fmt.Sprintf("qr-%s.%s", id, services.FileExtension(format))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, services.ContentType(format), img)
+}
+
+// whether an If-None-Match header names etag. the header is a list of tags or *,
+// weak tags are compared by their value
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// the image format with the highest q-value in an Accept header, the first listed
+// wins a tie. wildcards are ignored and q=0 rules a type out
+func formatFromAccept(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		format := services.FormatForContentType(strings.TrimSpace(params[0]))
+		if format == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// list the fonts available for captions
+func (h *QRHandler) ListFonts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"fonts": services.FontNames()})
+}
+
+// list the frame templates that can be drawn around a code
+func (h *QRHandler) ListFrames(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"frames": services.FrameNames()})
+}
+
 func (h *QRHandler) GetQRCodeByURL(c *gin.Context) {
 	url := c.Query("url")
 	if url == "" {
@@ -86,7 +205,99 @@ func (h *QRHandler) GetQRCodeByURL(c *gin.Context) {
 	c.JSON(200, qr)
 }
 
-// delete the qr code by id
+// change where the qr code points or when it expires
+func (h *QRHandler) UpdateQRCode(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code ID is required"})
+		return
+	}
+
+	var req models.QRCodeUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if strings.Contains(err.Error(), "Field validation for 'URL' failed") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Please enter a valid link."})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	qr, err := h.qrService.UpdateQRCode(id, &req)
+	if err != nil {
+		var verr *services.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "QR code not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, qr)
+}
+
+// send scans of the qr code to the holding page until it is resumed
+func (h *QRHandler) PauseQRCode(c *gin.Context) {
+	h.setStatus(c, models.StatusPaused)
+}
+
+// make a paused or archived qr code live again
+func (h *QRHandler) ResumeQRCode(c *gin.Context) {
+	h.setStatus(c, models.StatusActive)
+}
+
+// retire the qr code, it is left out of lookups but keeps its scans
+func (h *QRHandler) ArchiveQRCode(c *gin.Context) {
+	h.setStatus(c, models.StatusArchived)
+}
+
+func (h *QRHandler) setStatus(c *gin.Context, status string) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code ID is required"})
+		return
+	}
+
+	qr, err := h.qrService.SetQRCodeStatus(id, status)
+	if err != nil {
+		if err.Error() == "QR code not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, qr)
+}
+
+// list every change of the qr code's destination
+func (h *QRHandler) GetDestinationHistory(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code ID is required"})
+		return
+	}
+
+	history, err := h.qrService.GetDestinationHistory(id)
+	if err != nil {
+		if err.Error() == "QR code not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "history": history})
+}
+
+// move the qr code to the trash, it can be restored until the trash is purged
 func (h *QRHandler) DeleteQRCode(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
@@ -103,6 +314,38 @@ func (h *QRHandler) DeleteQRCode(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// take the qr code back out of the trash
+func (h *QRHandler) RestoreQRCode(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code ID is required"})
+		return
+	}
+
+	qr, err := h.qrService.RestoreQRCode(id)
+	if err != nil {
+		if err.Error() == "QR code not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, qr)
+}
+
+// list the qr codes in the trash with when each one is purged
+func (h *QRHandler) ListTrash(c *gin.Context) {
+	trashed, err := h.qrService.ListTrash()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"trash": trashed})
+}
+
 func (h *QRHandler) GetScanCount(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
@@ -110,7 +353,7 @@ func (h *QRHandler) GetScanCount(c *gin.Context) {
 		return
 	}
 
-	qr, err := h.qrService.GetQRCode(id)
+	qr, err := h.qrService.FindQRCode(id)
 	if err != nil {
 		if err.Error() == "QR code not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
@@ -120,9 +363,17 @@ func (h *QRHandler) GetScanCount(c *gin.Context) {
 		return
 	}
 
+	variants, err := h.qrService.VariantScanCounts(qr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"id":         id,
-		"scan_count": qr.ScanCount,
-		"expires_at": qr.ExpiresAt,
+		"id":           id,
+		"scan_count":   qr.ScanCount,
+		"unlock_count": qr.UnlockCount,
+		"expires_at":   qr.ExpiresAt,
+		"variants":     variants,
 	})
 }
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// upload a logo as the "logo" field of a multipart form, the returned id is used as logo_id
+func (h *QRHandler) UploadLogo(c *gin.Context) {
+	file, err := c.FormFile("logo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "logo file is required"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	// read one byte past the limit so the service can reject oversized logos
+	data, err := io.ReadAll(io.LimitReader(f, services.MaxLogoBytes+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logo, err := h.qrService.UploadLogo(data)
+	if err != nil {
+		var verr *services.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, logo)
+}
+
+// get the raw logo image
+func (h *QRHandler) GetLogo(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "logo ID is required"})
+		return
+	}
+
+	logo, err := h.qrService.GetLogo(id)
+	if err != nil {
+		if err.Error() == "logo not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// logos are content addressed and never change
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(http.StatusOK, logo.ContentType, logo.Data)
+}
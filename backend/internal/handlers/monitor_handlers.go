@@ -4,9 +4,10 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -18,10 +19,41 @@ var qrScansTotal = prometheus.NewCounterVec(
 	[]string{"qr_id"},
 )
 
+// returning scanners of a sticky split keep their variant for this long
+const variantCookieMaxAge = 30 * 24 * 60 * 60
+
+// each code remembers its variant in its own cookie, scoped to its redirect path
+func variantCookie(id string) string {
+	return "qr_variant_" + id
+}
+
 func init() {
 	prometheus.MustRegister(qrScansTotal)
 }
 
+// where the code sends scanners instead of its destination, empty while it is live.
+// archived codes are retired like expired ones
+func closedURL(qr *models.QRCode) string {
+	switch {
+	case qr.IsExpired(), qr.Status == models.StatusArchived:
+		return os.Getenv("FRONTEND_URL") + "/expiration"
+	case qr.Status == models.StatusPaused:
+		if url := os.Getenv("QR_PAUSED_URL"); url != "" {
+			return url
+		}
+		return os.Getenv("FRONTEND_URL") + "/paused"
+	}
+	return ""
+}
+
+// where codes that used up their max_scans send scanners
+func exhaustedURL() string {
+	if url := os.Getenv("QR_EXHAUSTED_URL"); url != "" {
+		return url
+	}
+	return os.Getenv("FRONTEND_URL") + "/exhausted"
+}
+
 // redirect to the server to aggregate the metrics
 func (h *QRHandler) HandleRedirect(c *gin.Context) {
 	id := c.Param("id")
@@ -30,28 +62,59 @@ func (h *QRHandler) HandleRedirect(c *gin.Context) {
 		return
 	}
 
-	qr, err := h.qrService.GetQRCode(id)
+	// the redirect path never needs the image, so skip rendering it
+	qr, err := h.qrService.FindQRCode(id)
 	if err != nil {
+		if err.Error() == "QR code not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if qr == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
+	if closed := closedURL(qr); closed != "" {
+		c.Redirect(http.StatusFound, closed)
 		return
 	}
 
-	if !qr.ExpiresAt.IsZero() && qr.ExpiresAt.Before(time.Now()) {
-		frontendURL := os.Getenv("FRONTEND_URL")
-		c.Redirect(http.StatusFound, frontendURL+"/expiration")
+	counted, err := h.qrService.IncrementScanCount(id)
+	if err != nil {
+		log.Printf("Failed to increment scan count for QR code %s: %v", id, err)
+	} else if !counted {
+		c.Redirect(http.StatusFound, exhaustedURL())
 		return
 	}
-
 	qrScansTotal.WithLabelValues(id).Inc()
 
-	if err := h.qrService.IncrementScanCount(id); err != nil {
-		log.Printf("Failed to increment scan count for QR code %s: %v", id, err)
+	// protected codes ask for the password first, the destination is only sent
+	// once it is right. the prompt's token lets this scan unlock the code once
+	if qr.PasswordHash != "" {
+		renderUnlockPage(c, http.StatusOK, h.qrService.UnlockToken(id), "")
+		return
+	}
+
+	h.sendToDestination(c, qr, http.StatusFound)
+}
+
+// redirect the scanner to wherever the code sends them and count the split variant
+func (h *QRHandler) sendToDestination(c *gin.Context, qr *models.QRCode, status int) {
+	cookie := variantCookie(qr.ID)
+	remembered, _ := c.Cookie(cookie)
+	redirect := h.qrService.Destination(qr, services.Visitor{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		Variant:   remembered,
+		Query:     c.Request.URL.Query(),
+	})
+	if redirect.Variant != "" {
+		if err := h.qrService.IncrementVariantScanCount(qr.ID, redirect.Variant); err != nil {
+			log.Printf("Failed to increment scan count of variant %s for QR code %s: %v", redirect.Variant, qr.ID, err)
+		}
+		if redirect.Sticky {
+			c.SetCookie(cookie, redirect.Variant, variantCookieMaxAge, "/r/"+qr.ID, "", false, true)
+		}
 	}
 
-	c.Redirect(http.StatusFound, qr.URL)
+	c.Redirect(status, redirect.URL)
 }
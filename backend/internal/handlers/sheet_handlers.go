@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// render a pdf of label sheets with the given codes
+func (h *QRHandler) CreateSheet(c *gin.Context) {
+	var req models.SheetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pdf, err := h.qrService.RenderSheet(&req)
+	if err != nil {
+		var verr *services.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="qr-sheet.pdf"`)
+	c.Data(http.StatusOK, services.ContentType(services.FormatPDF), pdf)
+}
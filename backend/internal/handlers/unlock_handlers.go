@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// the password prompt of protected codes. the form posts back to the scanned
+// url so its query is kept for forwarding
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; padding: 4rem 1rem; background: #f5f5f5; }
+form { background: #fff; padding: 2rem; border-radius: 8px; max-width: 320px; width: 100%; box-shadow: 0 1px 4px rgba(0, 0, 0, .1); }
+input, button { width: 100%; box-sizing: border-box; padding: .6rem; margin-top: .8rem; font-size: 1rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<form method="post">
+<h1>Password required</h1>
+<p>This QR code is protected, enter its password to continue.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="password" name="password" autocomplete="current-password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// token ties the answer to the scan that showed the prompt
+func renderUnlockPage(c *gin.Context, status int, token, message string) {
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := unlockPage.Execute(c.Writer, gin.H{"Token": token, "Error": message}); err != nil {
+		log.Printf("Failed to render unlock page: %v", err)
+	}
+}
+
+// check the password posted from the prompt and send the scanner on when it is right
+func (h *QRHandler) UnlockQRCode(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code ID is required"})
+		return
+	}
+
+	qr, err := h.qrService.FindQRCode(id)
+	if err != nil {
+		if err.Error() == "QR code not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if closed := closedURL(qr); closed != "" {
+		c.Redirect(http.StatusSeeOther, closed)
+		return
+	}
+	// nothing to unlock, send the scanner back to the redirect so the scan is counted
+	if qr.PasswordHash == "" {
+		c.Redirect(http.StatusSeeOther, c.Request.URL.RequestURI())
+		return
+	}
+
+	token := c.PostForm("token")
+	err = h.qrService.UnlockQRCode(qr, c.PostForm("password"), token, c.ClientIP())
+	switch {
+	case errors.Is(err, services.ErrUnlockExpired):
+		// back through the redirect, which counts the scan and shows a new prompt
+		c.Redirect(http.StatusSeeOther, c.Request.URL.RequestURI())
+		return
+	case errors.Is(err, services.ErrTooManyAttempts):
+		renderUnlockPage(c, http.StatusTooManyRequests, token, "Too many attempts, try again later.")
+		return
+	case errors.Is(err, services.ErrWrongPassword):
+		renderUnlockPage(c, http.StatusUnauthorized, token, "Wrong password, try again.")
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.qrService.IncrementUnlockCount(id); err != nil {
+		log.Printf("Failed to increment unlock count for QR code %s: %v", id, err)
+	}
+	h.sendToDestination(c, qr, http.StatusSeeOther)
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// logo image stored once and referenced by id from any number of qr codes
+type Logo struct {
+	ID          string    `json:"id"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	CreatedAt   time.Time `json:"created_at"`
+	Data        []byte    `json:"-"`
+}
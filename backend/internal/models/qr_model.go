@@ -1,19 +1,157 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
 
 type QRCode struct {
-	ID          string    `json:"id"`
-	URL         string    `json:"url"`
-	CreatedAt   time.Time `json:"created_at"`
-	ExpiresAt   time.Time `json:"expires_at,omitempty"`
-	ImageBase64 string    `json:"image_base64,omitempty"`
-	ScanCount   int       `json:"scan_count"`
+	ID            string        `json:"id"`
+	URL           string        `json:"url"`
+	CreatedAt     time.Time     `json:"created_at"`
+	ExpiresAt     time.Time     `json:"expires_at,omitempty"`
+	ScanCount     int           `json:"scan_count"`
+	Options       RenderOptions `json:"options"`
+	RedirectRules RedirectRules `json:"redirect_rules,omitempty"`
+	Schedule      Schedule      `json:"schedule"`
+	Split         Split         `json:"split"`
+	Tracking      Tracking      `json:"tracking"`
+	// bcrypt hash, scans have to enter the password when set
+	PasswordHash string `json:"-"`
+	UnlockCount  int    `json:"unlock_count"`
+	// scans allowed before the code is used up, 0 for no limit
+	MaxScans int `json:"max_scans"`
+	// one of the Status values, empty counts as active
+	Status string `json:"status"`
+	// set while the code is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// lifecycle states of a code. paused codes send scanners to a holding page,
+// archived codes are retired and left out of lookups but keep their scans
+const (
+	StatusActive   = "active"
+	StatusPaused   = "paused"
+	StatusArchived = "archived"
+)
+
+// whether the code is past its expiry time
+func (q *QRCode) IsExpired() bool {
+	return !q.ExpiresAt.IsZero() && q.ExpiresAt.Before(time.Now())
+}
+
+// options used to render the qr image, stored as json so a code can be re-rendered
+type RenderOptions struct {
+	Format          string  `json:"format,omitempty"`
+	ErrorCorrection string  `json:"error_correction,omitempty"`
+	SizePx          int     `json:"size_px,omitempty"`
+	ForegroundColor string  `json:"foreground_color,omitempty"`
+	BackgroundColor string  `json:"background_color,omitempty"`
+	Transparent     bool    `json:"transparent,omitempty"`
+	ModuleStyle     string  `json:"module_style,omitempty"`
+	FinderStyle     string  `json:"finder_style,omitempty"`
+	FinderColor     string  `json:"finder_color,omitempty"`
+	LogoID          string  `json:"logo_id,omitempty"`
+	Caption         string  `json:"caption,omitempty"`
+	HideCaption     bool    `json:"hide_caption,omitempty"`
+	Font            string  `json:"font,omitempty"`
+	FontSize        float64 `json:"font_size,omitempty"`
+	Frame           string  `json:"frame,omitempty"`
+	FrameColor      string  `json:"frame_color,omitempty"`
+	FrameText       string  `json:"frame_text,omitempty"`
+	WidthMM         float64 `json:"width_mm,omitempty"`
+	DPI             int     `json:"dpi,omitempty"`
+}
+
+func (o RenderOptions) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+func (o *RenderOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*o = RenderOptions{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	default:
+		return errors.New("unsupported type for render options")
+	}
 }
 
 type QRCodeRequest struct {
-	URL          string `json:"url" binding:"required,url"`
-	ExpiresInSec int64  `json:"expires_in_sec,omitempty"`
+	URL             string  `json:"url" binding:"required,url"`
+	Slug            string  `json:"slug,omitempty"`
+	ExpiresInSec    int64   `json:"expires_in_sec,omitempty"`
+	MaxScans        int     `json:"max_scans,omitempty"`
+	Format          string  `json:"format,omitempty"`
+	ErrorCorrection string  `json:"error_correction,omitempty"`
+	SizePx          int     `json:"size_px,omitempty"`
+	ForegroundColor string  `json:"foreground_color,omitempty"`
+	BackgroundColor string  `json:"background_color,omitempty"`
+	Transparent     bool    `json:"transparent,omitempty"`
+	ModuleStyle     string  `json:"module_style,omitempty"`
+	FinderStyle     string  `json:"finder_style,omitempty"`
+	FinderColor     string  `json:"finder_color,omitempty"`
+	LogoID          string  `json:"logo_id,omitempty"`
+	Caption         string  `json:"caption,omitempty"`
+	HideCaption     bool    `json:"hide_caption,omitempty"`
+	Font            string  `json:"font,omitempty"`
+	FontSize        float64 `json:"font_size,omitempty"`
+	Frame           string  `json:"frame,omitempty"`
+	FrameColor      string  `json:"frame_color,omitempty"`
+	FrameText       string  `json:"frame_text,omitempty"`
+	WidthMM         float64 `json:"width_mm,omitempty"`
+	DPI             int     `json:"dpi,omitempty"`
+
+	// tried in order before falling back to url
+	RedirectRules RedirectRules `json:"redirect_rules,omitempty" binding:"omitempty,dive"`
+	Schedule      *Schedule     `json:"schedule,omitempty"`
+	Split         *Split        `json:"split,omitempty"`
+	Tracking      *Tracking     `json:"tracking,omitempty"`
+	// scans have to enter it before they are sent on
+	Password string `json:"password,omitempty"`
+}
+
+// fields of a code that can change after it is printed, unset fields are left alone.
+// an expires_in_sec or max_scans of 0 removes the limit
+type QRCodeUpdate struct {
+	URL          *string `json:"url,omitempty" binding:"omitempty,url"`
+	ExpiresInSec *int64  `json:"expires_in_sec,omitempty"`
+	MaxScans     *int    `json:"max_scans,omitempty"`
+	// replace all rules, windows, variants or tracking, empty values remove them
+	RedirectRules *RedirectRules `json:"redirect_rules,omitempty" binding:"omitempty,dive"`
+	Schedule      *Schedule      `json:"schedule,omitempty"`
+	Split         *Split         `json:"split,omitempty"`
+	Tracking      *Tracking      `json:"tracking,omitempty"`
+	// an empty password removes the protection
+	Password *string `json:"password,omitempty"`
+}
+
+// a code in the trash, it is purged for good at PurgeAt unless restored first
+type TrashedQRCode struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	ScanCount int       `json:"scan_count"`
+	Status    string    `json:"status"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// one change of where a code points, kept so a repointed code can be traced back
+type DestinationChange struct {
+	ID           int64     `json:"id"`
+	QRCodeID     string    `json:"qr_code_id"`
+	OldURL       string    `json:"old_url"`
+	NewURL       string    `json:"new_url"`
+	OldExpiresAt time.Time `json:"old_expires_at,omitempty"`
+	NewExpiresAt time.Time `json:"new_expires_at,omitempty"`
+	ChangedAt    time.Time `json:"changed_at"`
 }
 
 type QRCodeResponse struct {
@@ -23,5 +161,26 @@ type QRCodeResponse struct {
 	CreatedAt   time.Time `json:"created_at"`
 	ExpiresAt   time.Time `json:"expires_at,omitempty"`
 	ImageBase64 string    `json:"image_base64,omitempty"`
-	ScanCount   int       `json:"scan_count"`
+	// whether the image was decoded back to its redirect url after rendering
+	Verified      bool          `json:"verified"`
+	ScanCount     int           `json:"scan_count"`
+	MaxScans      int           `json:"max_scans,omitempty"`
+	Status        string        `json:"status"`
+	RedirectRules RedirectRules `json:"redirect_rules,omitempty"`
+	Schedule      *Schedule     `json:"schedule,omitempty"`
+	Split         *Split        `json:"split,omitempty"`
+	Tracking      *Tracking     `json:"tracking,omitempty"`
+	// scans that entered the right password, counted apart from scan_count
+	UnlockCount       int  `json:"unlock_count"`
+	PasswordProtected bool `json:"password_protected"`
+	RenderOptions
+}
+
+// a qr symbol found in an uploaded image. codes of this service are resolved to
+// the stored code, qr_code is left out for anything else
+type DecodedSymbol struct {
+	Text    string          `json:"text"`
+	ID      string          `json:"id,omitempty"`
+	QRCode  *QRCodeResponse `json:"qr_code,omitempty"`
+	Expired bool            `json:"expired"`
 }
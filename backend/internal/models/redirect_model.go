@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// RedirectRule sends scans matching all of its conditions to URL instead of the
+// code's url. Empty conditions match everyone
+type RedirectRule struct {
+	OS        string   `json:"os,omitempty"`        // ios, android, windows, macos, linux or chromeos
+	Device    string   `json:"device,omitempty"`    // mobile, tablet or desktop
+	Countries []string `json:"countries,omitempty"` // ISO 3166 codes like DE, matching any of them
+	URL       string   `json:"url" binding:"required,url"`
+}
+
+// rules of a code in the order they are tried, stored as json
+type RedirectRules []RedirectRule
+
+func (r RedirectRules) Value() (driver.Value, error) {
+	if r == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r)
+}
+
+func (r *RedirectRules) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return errors.New("unsupported type for redirect rules")
+	}
+}
+
+// Schedule sends scans to a different url depending on the time. Window times
+// are wall clock times in Timezone, so a window follows daylight saving
+type Schedule struct {
+	Timezone string           `json:"timezone,omitempty"` // IANA name like Europe/Berlin, UTC when empty
+	Windows  []ScheduleWindow `json:"windows" binding:"dive"`
+}
+
+// ScheduleWindow covers Start up to but not including End, formatted like
+// 2006-01-02T15:04:05. An empty Start or End leaves that side open
+type ScheduleWindow struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	URL   string `json:"url" binding:"required,url"`
+}
+
+func (s Schedule) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *Schedule) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = Schedule{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("unsupported type for schedule")
+	}
+}
+
+// Split sends each scan to one of its variants, picked at random by weight
+type Split struct {
+	Variants []Variant `json:"variants" binding:"dive"`
+	// returning scanners get the variant they got before, remembered in a cookie
+	Sticky bool `json:"sticky,omitempty"`
+}
+
+// Variant is one destination of a split. Weights are relative, 80 and 20 send
+// four of five scans to the first variant
+type Variant struct {
+	Name   string `json:"name,omitempty"`
+	URL    string `json:"url" binding:"required,url"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+func (s Split) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *Split) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = Split{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("unsupported type for split")
+	}
+}
+
+// scans a variant got, for the analytics endpoint
+type VariantScanCount struct {
+	Name      string `json:"name"`
+	URL       string `json:"url,omitempty"` // empty for variants since removed from the split
+	Weight    int    `json:"weight,omitempty"`
+	ScanCount int    `json:"scan_count"`
+}
+
+// Tracking adds query parameters to wherever a scan is sent. Parameters already
+// in the destination url are never replaced
+type Tracking struct {
+	// parameters like utm_campaign. {id} and {variant} in a value are replaced
+	// with the code's id and the split variant of the scan
+	UTM map[string]string `json:"utm,omitempty"`
+	// pass the query of the /r/:id request on to the destination
+	ForwardQuery bool `json:"forward_query,omitempty"`
+}
+
+func (t Tracking) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+func (t *Tracking) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = Tracking{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	default:
+		return errors.New("unsupported type for tracking")
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+// a print sheet of stored codes laid out in a label grid
+type SheetRequest struct {
+	IDs      []string      `json:"ids" binding:"required"`
+	Template LabelTemplate `json:"template"`
+}
+
+// a label sheet. codes fill the labels row by row, starting a new page when the
+// sheet is full. sizes are in millimeters
+type LabelTemplate struct {
+	PageSize       string  `json:"page_size,omitempty"` // custom or one of pageSizes in services/qr_sheet.go
+	PageWidthMM    float64 `json:"page_width_mm,omitempty"`
+	PageHeightMM   float64 `json:"page_height_mm,omitempty"`
+	Rows           int     `json:"rows"`
+	Columns        int     `json:"columns"`
+	MarginTopMM    float64 `json:"margin_top_mm,omitempty"`
+	MarginBottomMM float64 `json:"margin_bottom_mm,omitempty"`
+	MarginLeftMM   float64 `json:"margin_left_mm,omitempty"`
+	MarginRightMM  float64 `json:"margin_right_mm,omitempty"`
+	ColumnGapMM    float64 `json:"column_gap_mm,omitempty"`
+	RowGapMM       float64 `json:"row_gap_mm,omitempty"`
+	// space kept clear inside each label
+	PaddingMM float64 `json:"padding_mm,omitempty"`
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	geoMu  sync.Mutex
+	geoDBs = map[string]*maxminddb.Reader{}
+
+	countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// the MaxMind format country or city database at GEOIP_DB, opened once per path.
+// nil when unset or unreadable, country rules then never match
+func geoDB() *maxminddb.Reader {
+	path := os.Getenv("GEOIP_DB")
+	if path == "" {
+		return nil
+	}
+
+	geoMu.Lock()
+	defer geoMu.Unlock()
+	if db, ok := geoDBs[path]; ok {
+		return db
+	}
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		log.Printf("Failed to open GeoIP database %s: %v", path, err)
+		db = nil
+	}
+	geoDBs[path] = db
+	return db
+}
+
+// the ISO 3166 country code of ip, empty when it can't be told
+func countryOf(ip string) string {
+	addr := net.ParseIP(ip)
+	db := geoDB()
+	if addr == nil || db == nil {
+		return ""
+	}
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := db.Lookup(addr, &record); err != nil {
+		return ""
+	}
+	return record.Country.ISOCode
+}
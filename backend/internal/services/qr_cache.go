@@ -0,0 +1,72 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+)
+
+const defaultImageCacheSize = 256
+
+// a rendered image and whether it decoded back to its redirect url. verified
+// only means something once checked is set
+type renderedImage struct {
+	data     []byte
+	checked  bool
+	verified bool
+}
+
+// bounded lru cache of rendered images. images are a pure function of the
+// cache key so entries never need to be invalidated, only evicted
+type imageCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type imageCacheEntry struct {
+	key string
+	img *renderedImage
+}
+
+func newImageCache(capacity int) *imageCache {
+	return &imageCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *imageCache) Get(key string) (*renderedImage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*imageCacheEntry).img, true
+}
+
+func (c *imageCache) Add(key string, img *renderedImage) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*imageCacheEntry).img = img
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&imageCacheEntry{key: key, img: img})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*imageCacheEntry).key)
+	}
+}
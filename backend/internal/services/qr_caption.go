@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/phucnguyen/qrify/internal/models"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	minFontSize      = 6
+	maxFontSize      = 72
+	defaultFontSize  = 14
+	maxCaptionLength = 100
+
+	// padding around the caption lines, chosen so a single line of the bitmap
+	// font keeps the original 20px strip with its baseline at 15px
+	captionPadTop    = 4
+	captionPadBottom = 3
+	captionMargin    = 4
+)
+
+type captionLine struct {
+	text string
+	dot  fixed.Point26_6 // start of the baseline, relative to the caption strip
+}
+
+// caption text wrapped and positioned inside a strip below the code
+type captionLayout struct {
+	face   font.Face
+	font   *sfnt.Font // nil when the built in bitmap font is used
+	ppem   fixed.Int26_6
+	lines  []captionLine
+	height int
+}
+
+func normalizeCaption(opts *models.RenderOptions) error {
+	opts.Caption = strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(opts.Caption))
+	if utf8.RuneCountInString(opts.Caption) > maxCaptionLength {
+		return invalidf("caption must be at most %d characters", maxCaptionLength)
+	}
+
+	if opts.Font != "" {
+		opts.Font = strings.ToLower(opts.Font)
+		if _, ok := findFont(opts.Font); !ok {
+			return invalidf("unknown font %q, available fonts are %s", opts.Font, strings.Join(FontNames(), ", "))
+		}
+	}
+	if opts.FontSize != 0 && (opts.FontSize < minFontSize || opts.FontSize > maxFontSize) {
+		return invalidf("font_size must be between %d and %d", minFontSize, maxFontSize)
+	}
+	return nil
+}
+
+// text printed below the code, the id unless a caption is set. empty when hidden
+func captionText(id string, opts models.RenderOptions) string {
+	if opts.HideCaption {
+		return ""
+	}
+	if opts.Caption != "" {
+		return opts.Caption
+	}
+	return id
+}
+
+// the original bitmap font is kept for plain ascii captions without a font choice
+func canUseBitmapFont(text string) bool {
+	for _, r := range text {
+		if _, ok := basicfont.Face7x13.GlyphAdvance(r); !ok && r != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// wrap and center text in a strip of the given width, nil for an empty caption
+func layoutCaption(text string, opts models.RenderOptions, width int) (*captionLayout, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	layout := &captionLayout{face: basicfont.Face7x13}
+	// print sized codes always use an outline font so the caption keeps its size in points
+	dpi := float64(pointsPerInch)
+	if opts.WidthMM != 0 {
+		dpi = float64(opts.DPI)
+	}
+	if opts.Font != "" || opts.FontSize != 0 || opts.WidthMM != 0 || !canUseBitmapFont(text) {
+		name, size := opts.Font, opts.FontSize
+		if name == "" {
+			name = defaultFont
+		}
+		if size == 0 {
+			size = defaultFontSize
+		}
+		f, ok := findFont(name)
+		if !ok {
+			return nil, fmt.Errorf("font %q is not available", name)
+		}
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: dpi, Hinting: font.HintingNone})
+		if err != nil {
+			return nil, err
+		}
+		layout.face = face
+		layout.font = f
+		layout.ppem = fixed.Int26_6(size * dpi / pointsPerInch * 64)
+	}
+
+	metrics := layout.face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	for i, line := range wrapText(layout.face, text, fixed.I(width-2*captionMargin)) {
+		advance := font.MeasureString(layout.face, line)
+		layout.lines = append(layout.lines, captionLine{
+			text: line,
+			dot: fixed.Point26_6{
+				X: fixed.I((width - advance.Round()) / 2),
+				Y: fixed.I(captionPadTop+i*lineHeight) + metrics.Ascent,
+			},
+		})
+	}
+	layout.height = captionPadTop + len(layout.lines)*lineHeight + captionPadBottom
+	return layout, nil
+}
+
+// greedy word wrap. words wider than a line, or scripts without spaces, are
+// broken between characters
+func wrapText(face font.Face, text string, maxWidth fixed.Int26_6) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if font.MeasureString(face, candidate) <= maxWidth {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for font.MeasureString(face, word) > maxWidth {
+				n := fitPrefix(face, word, maxWidth)
+				lines = append(lines, word[:n])
+				word = word[n:]
+			}
+			line = word
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// byte length of the longest prefix of s that fits, at least one character
+func fitPrefix(face font.Face, s string, maxWidth fixed.Int26_6) int {
+	end := 0
+	for i, r := range s {
+		next := i + utf8.RuneLen(r)
+		if end > 0 && font.MeasureString(face, s[:next]) > maxWidth {
+			break
+		}
+		end = next
+	}
+	return end
+}
+
+// rasterize the caption into an alpha mask the width of the strip
+func (l *captionLayout) mask(width int) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, width, l.height))
+	d := &font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: l.face,
+	}
+	for _, line := range l.lines {
+		d.Dot = line.dot
+		d.DrawString(line.text)
+	}
+	return mask
+}
+
+// write the caption as svg path data. outline fonts are written as their glyph
+// outlines, the bitmap font as runs of its pixels
+func (l *captionLayout) writePath(buf *bytes.Buffer, width int) error {
+	if l.font == nil {
+		writeMaskRuns(buf, l.mask(width))
+		return nil
+	}
+
+	p, err := l.path(width)
+	if err != nil {
+		return err
+	}
+	p.writeSVG(buf)
+	return nil
+}
+
+// the caption as a vector path relative to the caption strip
+func (l *captionLayout) path(width int) (*Path, error) {
+	p := &Path{}
+	if l.font == nil {
+		mask := l.mask(width)
+		b := mask.Bounds()
+		row := make([]bool, b.Dx())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				row[x-b.Min.X] = mask.AlphaAt(x, y).A >= 0x80
+			}
+			eachRun(row, func(start, end int) {
+				p.Rect(float32(start), float32(y-b.Min.Y), float32(end-start), 1)
+			})
+		}
+		return p, nil
+	}
+
+	for _, line := range l.lines {
+		if err := appendTextPath(p, l.font, l.ppem, line.text, line.dot); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultForeground = "#000000"
+	defaultBackground = "#ffffff"
+
+	// wcag contrast ratio below which phone cameras start failing to pick up the modules
+	minContrastRatio = 3.0
+	// wcag contrast ratio for normal sized text
+	minTextContrastRatio = 4.5
+)
+
+// parse #rgb or #rrggbb, the leading # is optional
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.NRGBA{}, invalidf("invalid color %q, expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, invalidf("invalid color %q, expected #rrggbb", s)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func normalizeColor(s string, fallback string) (string, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	c, err := parseHexColor(s)
+	if err != nil {
+		return "", err
+	}
+	return hexColor(c), nil
+}
+
+// relative luminance as defined by wcag 2
+func luminance(c color.NRGBA) float64 {
+	channel := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.03928 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.R) + 0.7152*channel(c.G) + 0.0722*channel(c.B)
+}
+
+func contrastRatio(a, b color.NRGBA) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// reject color pairs that won't scan. many readers can't handle light modules on a
+// dark background, so the foreground must also be the darker color
+func checkContrast(fg, bg color.NRGBA) error {
+	if luminance(fg) >= luminance(bg) {
+		return invalidf("foreground color %s must be darker than background color %s", hexColor(fg), hexColor(bg))
+	}
+	if ratio := contrastRatio(fg, bg); ratio < minContrastRatio {
+		return invalidf("contrast between %s and %s is %.1f:1, at least %.1f:1 is needed to scan reliably", hexColor(fg), hexColor(bg), ratio, minContrastRatio)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	multiqrcode "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/phucnguyen/qrify/internal/models"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	MaxDecodeBytes = 10 << 20
+	// larger uploads are refused before decoding so a small file can't expand
+	// into a huge bitmap, 25 megapixels is still 100MB once decoded
+	maxDecodePixels = 25_000_000
+	// photos are scaled down to this before decoding, codes stay well readable
+	decodeScanDimension = 2048
+)
+
+// decode every qr symbol in an uploaded png or jpeg. symbols pointing at one of
+// our redirect urls are resolved to the stored code
+func (s *QRService) DecodeImage(data []byte) ([]models.DecodedSymbol, error) {
+	if len(data) == 0 {
+		return nil, invalidf("image is empty")
+	}
+	if len(data) > MaxDecodeBytes {
+		return nil, invalidf("image must be at most %d bytes", MaxDecodeBytes)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return nil, invalidf("image must be a PNG or JPEG")
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+		return nil, invalidf("image must be at most %d megapixels", maxDecodePixels/1_000_000)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, invalidf("image must be a PNG or JPEG")
+	}
+
+	symbols := []models.DecodedSymbol{}
+	for _, text := range decodeQRCodes(scaleForDecoding(img)) {
+		symbol := models.DecodedSymbol{Text: text}
+		if id, ok := idFromRedirectURL(text); ok {
+			symbol.ID = id
+			qr, err := s.FindQRCode(id)
+			if err != nil && err.Error() != "QR code not found" {
+				return nil, err
+			}
+			if qr != nil {
+				if symbol.QRCode, err = s.toResponse(qr); err != nil {
+					return nil, err
+				}
+				symbol.Expired = qr.IsExpired()
+			}
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, nil
+}
+
+// the text of every qr symbol found in img, without duplicates
+func decodeQRCodes(img image.Image) []string {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(withQuietZone(img, 8))
+	if err != nil {
+		return nil
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+
+	var texts []string
+	seen := map[string]bool{}
+	results, _ := multiqrcode.NewQRCodeMultiReader().DecodeMultiple(bmp, hints)
+	for _, result := range results {
+		if text := result.GetText(); !seen[text] {
+			seen[text] = true
+			texts = append(texts, text)
+		}
+	}
+	// the multi reader gives up on some codes the single reader still finds
+	if len(texts) == 0 {
+		if text, err := decodeQRCode(img); err == nil {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// shrink large photos, decoding time grows with the pixel count
+func scaleForDecoding(img image.Image) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= decodeScanDimension && b.Dy() <= decodeScanDimension {
+		return img
+	}
+	dst := fitRect(image.Rect(0, 0, decodeScanDimension, decodeScanDimension), b)
+	out := image.NewNRGBA(dst.Sub(dst.Min))
+	xdraw.ApproxBiLinear.Scale(out, out.Bounds(), img, b, xdraw.Src, nil)
+	return out
+}
+
+// the id of a code from its redirect url
+func idFromRedirectURL(text string) (string, bool) {
+	id, ok := strings.CutPrefix(text, redirectURL(""))
+	if !ok || id == "" || strings.ContainsAny(id, "/?#") {
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+const (
+	defaultFontsDir = "fonts"
+	// used when a font size is set without a font, or the text needs glyphs the
+	// built in bitmap font doesn't have
+	defaultFont = "go-regular"
+)
+
+var (
+	fontsMu  sync.Mutex
+	fontSets = map[string]map[string]*sfnt.Font{}
+)
+
+// truetype and opentype fonts in FONTS_DIR, keyed by lowercased file name without
+// extension. each directory is read once
+func loadFonts() map[string]*sfnt.Font {
+	dir := os.Getenv("FONTS_DIR")
+	if dir == "" {
+		dir = defaultFontsDir
+	}
+
+	fontsMu.Lock()
+	defer fontsMu.Unlock()
+	if fonts, ok := fontSets[dir]; ok {
+		return fonts
+	}
+
+	fonts := map[string]*sfnt.Font{}
+	// the default and frame fonts are compiled in so they work without the directory
+	if f, err := sfnt.Parse(goregular.TTF); err == nil {
+		fonts[defaultFont] = f
+	}
+	if f, err := sfnt.Parse(gobold.TTF); err == nil {
+		fonts[frameFont] = f
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".ttf" && ext != ".otf") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		f, err := sfnt.Parse(data)
+		if err != nil {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		fonts[name] = f
+	}
+
+	fontSets[dir] = fonts
+	return fonts
+}
+
+// names of the fonts captions can use
+func FontNames() []string {
+	fonts := loadFonts()
+	names := make([]string, 0, len(fonts))
+	for name := range fonts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func findFont(name string) (*sfnt.Font, bool) {
+	f, ok := loadFonts()[strings.ToLower(name)]
+	return f, ok
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/phucnguyen/qrify/internal/models"
+	"golang.org/x/image/font/sfnt"
+)
+
+const (
+	defaultFrameText   = "SCAN ME"
+	maxFrameTextLength = 30
+	// frame text is bold unless the code picks a caption font
+	frameFont = "go-bold"
+)
+
+// FrameParams are the per code settings a frame is drawn with
+type FrameParams struct {
+	Color      color.NRGBA // the frame itself
+	TextColor  color.NRGBA // text drawn on top of Color
+	Background color.NRGBA
+	Text       string
+	Font       *sfnt.Font
+}
+
+// Frame draws a decoration around the code and its caption. Frames are
+// registered by name with RegisterFrame and picked with the frame option
+type Frame interface {
+	// Layout returns the size of the framed image and where the content of the
+	// given size is placed inside it
+	Layout(content image.Point) (size image.Point, offset image.Point)
+	// Shapes returns what to draw behind the content, in the order it is drawn
+	Shapes(size image.Point, content image.Rectangle, p FrameParams) ([]Shape, error)
+}
+
+var (
+	framesMu sync.RWMutex
+	frames   = map[string]Frame{}
+)
+
+// RegisterFrame makes a frame available under name. It panics if the name is
+// already taken, like database/sql.Register
+func RegisterFrame(name string, f Frame) {
+	framesMu.Lock()
+	defer framesMu.Unlock()
+	if _, ok := frames[name]; ok {
+		panic("services: RegisterFrame called twice for frame " + name)
+	}
+	frames[name] = f
+}
+
+func findFrame(name string) (Frame, bool) {
+	framesMu.RLock()
+	defer framesMu.RUnlock()
+	f, ok := frames[name]
+	return f, ok
+}
+
+// names of the registered frames
+func FrameNames() []string {
+	framesMu.RLock()
+	defer framesMu.RUnlock()
+	names := make([]string, 0, len(frames))
+	for name := range frames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterFrame("banner", bannerFrame{})
+	RegisterFrame("scan-me", scanMeFrame{})
+	RegisterFrame("phone", phoneFrame{})
+}
+
+func normalizeFrame(opts *models.RenderOptions) error {
+	if opts.Frame == "" {
+		opts.FrameColor = ""
+		opts.FrameText = ""
+		return nil
+	}
+
+	opts.Frame = strings.ToLower(opts.Frame)
+	if _, ok := findFrame(opts.Frame); !ok {
+		return invalidf("unknown frame %q, available frames are %s", opts.Frame, strings.Join(FrameNames(), ", "))
+	}
+	var err error
+	if opts.FrameColor, err = normalizeColor(opts.FrameColor, opts.ForegroundColor); err != nil {
+		return err
+	}
+	opts.FrameText = strings.TrimSpace(opts.FrameText)
+	if opts.FrameText == "" {
+		opts.FrameText = defaultFrameText
+	}
+	if utf8.RuneCountInString(opts.FrameText) > maxFrameTextLength {
+		return invalidf("frame_text must be at most %d characters", maxFrameTextLength)
+	}
+	return nil
+}
+
+// frame params for normalized options
+func frameParams(opts models.RenderOptions, bg color.NRGBA) (FrameParams, error) {
+	c, err := parseHexColor(opts.FrameColor)
+	if err != nil {
+		return FrameParams{}, err
+	}
+
+	name := frameFont
+	if opts.Font != "" {
+		name = opts.Font
+	}
+	f, ok := findFont(name)
+	if !ok {
+		return FrameParams{}, fmt.Errorf("font %q is not available", name)
+	}
+
+	return FrameParams{
+		Color:      c,
+		TextColor:  textColorOn(c),
+		Background: bg,
+		Text:       opts.FrameText,
+		Font:       f,
+	}, nil
+}
+
+// whichever of black and white stands out more on c
+func textColorOn(c color.NRGBA) color.NRGBA {
+	black := color.NRGBA{A: 0xff}
+	white := color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	if contrastRatio(c, white) > contrastRatio(c, black) {
+		return white
+	}
+	return black
+}
+
+// size of the framed image, the content offset and the shapes behind the content
+func (d *qrDrawing) frameLayout(content image.Point) (image.Point, image.Point, []Shape, error) {
+	size, offset := d.frame.Layout(content)
+	shapes, err := d.frame.Shapes(size, image.Rectangle{Min: offset, Max: offset.Add(content)}, d.frameParams)
+	return size, offset, shapes, err
+}
+
+// draw the frame and place the content image inside it
+func drawFrame(content image.Image, d *qrDrawing) (image.Image, error) {
+	size, offset, shapes, err := d.frameLayout(content.Bounds().Size())
+	if err != nil {
+		return nil, err
+	}
+
+	out := image.NewNRGBA(image.Rectangle{Max: size})
+	draw.Draw(out, out.Bounds(), image.NewUniform(d.bg), image.Point{}, draw.Src)
+	for _, shape := range shapes {
+		shape.Path.fill(out, shape.Color)
+	}
+	draw.Draw(out, content.Bounds().Sub(content.Bounds().Min).Add(offset), content, content.Bounds().Min, draw.Over)
+	return out, nil
+}
+
+// size unit frames are measured in, so they scale with the code
+func frameUnit(content image.Point) float32 {
+	u := float32(content.X) / 32
+	if u < 2 {
+		u = 2
+	}
+	return u
+}
+
+func ceil(f float32) int {
+	i := int(f)
+	if float32(i) < f {
+		i++
+	}
+	return i
+}
+
+// a border around the code with a rounded banner below it
+type bannerFrame struct{}
+
+func (bannerFrame) Layout(content image.Point) (image.Point, image.Point) {
+	u := frameUnit(content)
+	pad := ceil(3 * u)
+	return image.Pt(content.X+2*pad, content.Y+2*pad+ceil(7*u)), image.Pt(pad, pad)
+}
+
+func (bannerFrame) Shapes(size image.Point, content image.Rectangle, p FrameParams) ([]Shape, error) {
+	u := frameUnit(content.Size())
+	w := float32(size.X)
+	borderH := float32(content.Max.Y) + 3*u
+
+	border := &Path{}
+	border.Ring(0, 0, w, borderH, 2*u, u)
+
+	banner := &Path{}
+	bannerY := borderH + u
+	bannerH := float32(size.Y) - bannerY
+	banner.RoundedRect(0, bannerY, w, bannerH, 2*u, true)
+
+	text, err := TextPath(p.Font, p.Text, 3*u, w/2, bannerY+bannerH/2+1.1*u, w-4*u)
+	if err != nil {
+		return nil, err
+	}
+	return []Shape{{border, p.Color}, {banner, p.Color}, {text, p.TextColor}}, nil
+}
+
+// a border with a "scan me" tab sitting on top of it
+type scanMeFrame struct{}
+
+func (scanMeFrame) Layout(content image.Point) (image.Point, image.Point) {
+	u := frameUnit(content)
+	pad := ceil(3 * u)
+	tab := ceil(6 * u)
+	return image.Pt(content.X+2*pad, content.Y+2*pad+tab), image.Pt(pad, tab+pad)
+}
+
+func (scanMeFrame) Shapes(size image.Point, content image.Rectangle, p FrameParams) ([]Shape, error) {
+	u := frameUnit(content.Size())
+	w, h := float32(size.X), float32(size.Y)
+	tabH := float32(content.Min.Y) - 3*u
+
+	border := &Path{}
+	border.Ring(0, tabH, w, h-tabH, 2*u, u)
+
+	// the tab runs into the top of the border so only its upper corners show round
+	tab := &Path{}
+	tabW := w * 0.6
+	tab.RoundedRect((w-tabW)/2, 0, tabW, tabH+2*u, 2*u, true)
+
+	text, err := TextPath(p.Font, p.Text, 3*u, w/2, tabH/2+1.6*u, tabW-2*u)
+	if err != nil {
+		return nil, err
+	}
+	return []Shape{{border, p.Color}, {tab, p.Color}, {text, p.TextColor}}, nil
+}
+
+// the outline of a phone with the code on its screen and the text below it
+type phoneFrame struct{}
+
+func (phoneFrame) Layout(content image.Point) (image.Point, image.Point) {
+	u := frameUnit(content)
+	side := ceil(4 * u)
+	top := ceil(8 * u)
+	bottom := ceil(12 * u)
+	return image.Pt(content.X+2*side, content.Y+top+bottom), image.Pt(side, top)
+}
+
+func (phoneFrame) Shapes(size image.Point, content image.Rectangle, p FrameParams) ([]Shape, error) {
+	u := frameUnit(content.Size())
+	w, h := float32(size.X), float32(size.Y)
+
+	body := &Path{}
+	body.Ring(0, 0, w, h, 5*u, 2*u)
+	speaker := w * 0.25
+	body.RoundedRect((w-speaker)/2, 4*u, speaker, u, u/2, true)
+
+	text, err := TextPath(p.Font, p.Text, 3.5*u, w/2, float32(content.Max.Y)+6.5*u, w-8*u)
+	if err != nil {
+		return nil, err
+	}
+	// the text sits on the background, the frame color is only used for it when
+	// it is dark enough there to read
+	textColor := p.Color
+	if contrastRatio(p.Color, p.Background) < minTextContrastRatio {
+		textColor = textColorOn(p.Background)
+	}
+	return []Shape{{body, p.Color}, {text, textColor}}, nil
+}
@@ -1,59 +1,109 @@
 package services
 
 import (
-	"crypto/rand"
 	"encoding/base64"
-	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"os"
+	"reflect"
+	"strconv"
 	"time"
 
-	"bytes"
-	"image/png"
-
 	_ "github.com/lib/pq"
 	"github.com/phucnguyen/qrify/internal/models"
-	"github.com/skip2/go-qrcode"
 )
 
 type QRService struct {
-	store QRCodeStore
+	store  QRCodeStore
+	images *imageCache
+	// failed unlocks per client address
+	unlocks *attemptLimiter
+	tokens  *unlockTokens
 }
 
 func NewQRService(store QRCodeStore) *QRService {
+	unlockWindow := time.Duration(envInt("QR_UNLOCK_WINDOW_SEC", defaultUnlockWindowSec)) * time.Second
 	return &QRService{
-		store: store,
+		store:   store,
+		images:  newImageCache(envInt("QR_IMAGE_CACHE_SIZE", defaultImageCacheSize)),
+		unlocks: newAttemptLimiter(envInt("QR_UNLOCK_ATTEMPTS", defaultUnlockAttempts), unlockWindow),
+		tokens:  newUnlockTokens(),
 	}
 }
 
+// read an integer setting from the environment, falling back when unset or invalid
+func envInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// returned for requests that can never succeed, handlers map it to 400
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.msg
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return &ValidationError{msg: fmt.Sprintf(format, args...)}
+}
+
 // generate qr code by url
 func (s *QRService) GenerateQRCode(req *models.QRCodeRequest) (*models.QRCodeResponse, error) {
 	if req.URL == "" {
 		return nil, errors.New("URL is required")
 	}
 
-	id, err := generateID()
+	opts, err := renderOptionsFromRequest(req)
 	if err != nil {
 		return nil, err
 	}
-	frontendURL := os.Getenv("FRONTEND_URL")
-	redirectURL := frontendURL + "/r/" + id
-	qrImg, err := qrcode.New(redirectURL, qrcode.Medium)
+
+	rules, err := normalizeRedirectRules(req.RedirectRules)
 	if err != nil {
 		return nil, err
 	}
-	qrImg.DisableBorder = true
-	img := qrImg.Image(256)
+	var schedule models.Schedule
+	if req.Schedule != nil {
+		if schedule, err = normalizeSchedule(*req.Schedule); err != nil {
+			return nil, err
+		}
+	}
+	var split models.Split
+	if req.Split != nil {
+		if split, err = normalizeSplit(*req.Split); err != nil {
+			return nil, err
+		}
+	}
+	var tracking models.Tracking
+	if req.Tracking != nil {
+		if tracking, err = normalizeTracking(*req.Tracking); err != nil {
+			return nil, err
+		}
+	}
+	passwordHash := ""
+	if req.Password != "" {
+		if passwordHash, err = hashPassword(req.Password); err != nil {
+			return nil, err
+		}
+	}
 
-	// Add the ID as text below the QR code
-	imgWithText, err := addTextBelow(img, id)
-	if err != nil {
-		return nil, err
+	slug := ""
+	if req.Slug != "" {
+		if slug, err = normalizeSlug(req.Slug); err != nil {
+			return nil, err
+		}
 	}
 
-	var buf bytes.Buffer
-	if err := png.Encode(&buf, imgWithText); err != nil {
-		return nil, err
+	if req.MaxScans < 0 {
+		return nil, invalidf("max_scans can't be negative")
 	}
 
 	expiresAt := time.Time{}
@@ -61,34 +111,181 @@ func (s *QRService) GenerateQRCode(req *models.QRCodeRequest) (*models.QRCodeRes
 		expiresAt = time.Now().UTC().Add(time.Duration(req.ExpiresInSec) * time.Second)
 	}
 
-	base64Img := base64.StdEncoding.EncodeToString(buf.Bytes())
-
 	qr := &models.QRCode{
-		ID:          id,
-		URL:         req.URL,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   expiresAt,
-		ImageBase64: base64Img,
+		URL:           req.URL,
+		CreatedAt:     time.Now(),
+		ExpiresAt:     expiresAt,
+		MaxScans:      req.MaxScans,
+		Status:        models.StatusActive,
+		Options:       opts,
+		RedirectRules: rules,
+		Schedule:      schedule,
+		Split:         split,
+		Tracking:      tracking,
+		PasswordHash:  passwordHash,
+	}
+	if err := s.createWithID(qr, slug); err != nil {
+		return nil, err
 	}
 
-	if err := s.store.Save(qr); err != nil {
+	return s.toResponse(qr)
+}
+
+// render and save a new code under its id. it is rendered first so a code that
+// can't be drawn is never stored
+func (s *QRService) createQRCode(qr *models.QRCode) error {
+	img, err := s.renderImage(qr, "", 0, true)
+	if err != nil {
+		return err
+	}
+	if !img.verified {
+		switch verifyMode() {
+		case verifyReject:
+			return invalidf("the rendered code does not scan, try stronger colors, a higher error_correction, plainer styles or a smaller logo")
+		case verifyWarn:
+			log.Printf("QR code %s does not decode to its redirect url", qr.ID)
+		}
+	}
+	return s.store.Save(qr)
+}
+
+// render the image of an existing qr code. an empty format or zero size uses
+// the options it was created with
+func (s *QRService) RenderImage(id string, format string, size int) ([]byte, string, error) {
+	qr, err := s.FindQRCode(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "" {
+		format = qr.Options.Format
+	}
+	if format, err = normalizeFormat(format); err != nil {
+		return nil, "", err
+	}
+	if size != 0 {
+		if _, err := normalizeSize(size); err != nil {
+			return nil, "", err
+		}
+	}
+
+	img, err := s.renderImage(qr, format, size, false)
+	if err != nil {
+		return nil, "", err
+	}
+	return img.data, format, nil
+}
+
+// render through the image cache, the key covers everything the image depends on.
+// with verify the image is also decoded to check it scans, once per cached image.
+// only the image drawn with the stored options is verified, other formats and
+// sizes share its geometry
+func (s *QRService) renderImage(qr *models.QRCode, format string, size int, verify bool) (*renderedImage, error) {
+	opts := qr.Options
+	if format != "" {
+		opts.Format = format
+	}
+	// an explicit pixel size replaces the printed width
+	if size != 0 {
+		opts.SizePx = size
+		opts.WidthMM = 0
+	}
+	opts, err := normalizeOptions(opts)
+	if err != nil {
 		return nil, err
 	}
 
-	response := &models.QRCodeResponse{
-		ID:          qr.ID,
-		URL:         qr.URL,
-		QRCodeURL:   "/r/" + qr.ID,
-		CreatedAt:   qr.CreatedAt,
-		ExpiresAt:   qr.ExpiresAt,
-		ImageBase64: qr.ImageBase64,
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s|%s|%s", os.Getenv("FRONTEND_URL"), qr.ID, options)
+	img, cached := s.images.Get(key)
+	if cached && (img.checked || !verify) {
+		return img, nil
 	}
 
-	return response, nil
+	logo, err := s.findLogo(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cached {
+		data, err := renderQRCode(qr.ID, opts, logo)
+		if err != nil {
+			return nil, err
+		}
+		img = &renderedImage{data: data}
+	}
+	if verify {
+		// cached images are shared, the checked one replaces it
+		checked := &renderedImage{data: img.data, checked: true}
+		if verifyMode() != verifyOff {
+			if checked.verified, err = verifyImage(qr.ID, opts, logo, img.data); err != nil {
+				return nil, err
+			}
+		}
+		img = checked
+	}
+	s.images.Add(key, img)
+	return img, nil
 }
 
-// get qr code by id
-func (s *QRService) GetQRCode(id string) (*models.QRCodeResponse, error) {
+// codes stored before statuses existed are active
+func statusOf(qr *models.QRCode) string {
+	if qr.Status == "" {
+		return models.StatusActive
+	}
+	return qr.Status
+}
+
+// build the api response, the image is rendered with the stored options
+func (s *QRService) toResponse(qr *models.QRCode) (*models.QRCodeResponse, error) {
+	opts, err := normalizeOptions(qr.Options)
+	if err != nil {
+		return nil, err
+	}
+	img, err := s.renderImage(qr, "", 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule *models.Schedule
+	if len(qr.Schedule.Windows) > 0 {
+		schedule = &qr.Schedule
+	}
+	var split *models.Split
+	if len(qr.Split.Variants) > 0 {
+		split = &qr.Split
+	}
+	var tracking *models.Tracking
+	if len(qr.Tracking.UTM) > 0 || qr.Tracking.ForwardQuery {
+		tracking = &qr.Tracking
+	}
+
+	return &models.QRCodeResponse{
+		ID:                qr.ID,
+		URL:               qr.URL,
+		QRCodeURL:         "/r/" + qr.ID,
+		CreatedAt:         qr.CreatedAt,
+		ExpiresAt:         qr.ExpiresAt,
+		ImageBase64:       base64.StdEncoding.EncodeToString(img.data),
+		Verified:          img.verified,
+		ScanCount:         qr.ScanCount,
+		MaxScans:          qr.MaxScans,
+		Status:            statusOf(qr),
+		RedirectRules:     qr.RedirectRules,
+		Schedule:          schedule,
+		Split:             split,
+		Tracking:          tracking,
+		UnlockCount:       qr.UnlockCount,
+		PasswordProtected: qr.PasswordHash != "",
+		RenderOptions:     opts,
+	}, nil
+}
+
+// find the stored qr code without rendering its image
+func (s *QRService) FindQRCode(id string) (*models.QRCode, error) {
 	qr, err := s.store.FindByID(id)
 	if err != nil {
 		return nil, err
@@ -96,33 +293,146 @@ func (s *QRService) GetQRCode(id string) (*models.QRCodeResponse, error) {
 	if qr == nil {
 		return nil, errors.New("QR code not found")
 	}
+	return qr, nil
+}
 
-	return &models.QRCodeResponse{
-		ID:          qr.ID,
-		URL:         qr.URL,
-		QRCodeURL:   "/r/" + qr.ID,
-		CreatedAt:   qr.CreatedAt,
-		ExpiresAt:   qr.ExpiresAt,
-		ImageBase64: qr.ImageBase64,
-		ScanCount:   qr.ScanCount,
-	}, nil
+// get qr code by id
+func (s *QRService) GetQRCode(id string) (*models.QRCodeResponse, error) {
+	qr, err := s.FindQRCode(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toResponse(qr)
 }
 
-// delete qr code by id
-func (s *QRService) DeleteQRCode(id string) error {
-	if err := s.store.DeleteByID(id); err != nil {
-		return err
+// repoint a code. the image only encodes the redirect url so it stays the same,
+// every change is recorded in the destination history
+func (s *QRService) UpdateQRCode(id string, req *models.QRCodeUpdate) (*models.QRCodeResponse, error) {
+	if req.URL == nil && req.ExpiresInSec == nil && req.MaxScans == nil && req.RedirectRules == nil && req.Schedule == nil && req.Split == nil && req.Tracking == nil && req.Password == nil {
+		return nil, invalidf("nothing to update, set url, expires_in_sec, max_scans, redirect_rules, schedule, split, tracking or password")
 	}
-	return nil
+	qr, err := s.FindQRCode(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *qr
+	if req.URL != nil {
+		updated.URL = *req.URL
+	}
+	if req.ExpiresInSec != nil {
+		switch {
+		case *req.ExpiresInSec < 0:
+			return nil, invalidf("expires_in_sec can't be negative")
+		case *req.ExpiresInSec == 0:
+			updated.ExpiresAt = time.Time{}
+		default:
+			updated.ExpiresAt = time.Now().UTC().Add(time.Duration(*req.ExpiresInSec) * time.Second)
+		}
+	}
+	routingChanged := false
+	// raising the limit gives a used up code more scans, lowering it below the
+	// scan count uses it up
+	if req.MaxScans != nil {
+		if *req.MaxScans < 0 {
+			return nil, invalidf("max_scans can't be negative")
+		}
+		routingChanged = *req.MaxScans != qr.MaxScans
+		updated.MaxScans = *req.MaxScans
+	}
+	if req.RedirectRules != nil {
+		rules, err := normalizeRedirectRules(*req.RedirectRules)
+		if err != nil {
+			return nil, err
+		}
+		routingChanged = routingChanged || !reflect.DeepEqual(rules, qr.RedirectRules) && (len(rules) > 0 || len(qr.RedirectRules) > 0)
+		updated.RedirectRules = rules
+	}
+	if req.Schedule != nil {
+		schedule, err := normalizeSchedule(*req.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		routingChanged = routingChanged || !reflect.DeepEqual(schedule, qr.Schedule)
+		updated.Schedule = schedule
+	}
+	if req.Split != nil {
+		split, err := normalizeSplit(*req.Split)
+		if err != nil {
+			return nil, err
+		}
+		routingChanged = routingChanged || !reflect.DeepEqual(split, qr.Split)
+		updated.Split = split
+	}
+	if req.Tracking != nil {
+		tracking, err := normalizeTracking(*req.Tracking)
+		if err != nil {
+			return nil, err
+		}
+		routingChanged = routingChanged || !reflect.DeepEqual(tracking, qr.Tracking)
+		updated.Tracking = tracking
+	}
+	// an empty password removes the protection
+	if req.Password != nil {
+		updated.PasswordHash = ""
+		if *req.Password != "" {
+			hash, err := hashPassword(*req.Password)
+			if err != nil {
+				return nil, err
+			}
+			updated.PasswordHash = hash
+		}
+		routingChanged = routingChanged || updated.PasswordHash != qr.PasswordHash
+	}
+
+	// the history tracks the fallback url and expiry, everything else is listed
+	// on the code itself
+	var change *models.DestinationChange
+	if updated.URL != qr.URL || !updated.ExpiresAt.Equal(qr.ExpiresAt) {
+		change = &models.DestinationChange{
+			QRCodeID:     id,
+			OldURL:       qr.URL,
+			NewURL:       updated.URL,
+			OldExpiresAt: qr.ExpiresAt,
+			NewExpiresAt: updated.ExpiresAt,
+			ChangedAt:    time.Now().UTC(),
+		}
+	} else if !routingChanged {
+		return s.toResponse(qr)
+	}
+	if err := s.store.Update(&updated, change); err != nil {
+		return nil, err
+	}
+	return s.toResponse(&updated)
 }
 
-// generate a random ID
-func generateID() (string, error) {
-	bytes := make([]byte, 8)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+// get the destination changes of a code, oldest first
+func (s *QRService) GetDestinationHistory(id string) ([]models.DestinationChange, error) {
+	if _, err := s.FindQRCode(id); err != nil {
+		return nil, err
 	}
-	return hex.EncodeToString(bytes), nil
+	return s.store.FindDestinationHistory(id)
+}
+
+// move a code to another lifecycle state, any state can be switched to any other
+func (s *QRService) SetQRCodeStatus(id, status string) (*models.QRCodeResponse, error) {
+	status, err := oneOf(status, "status", []string{models.StatusActive, models.StatusPaused, models.StatusArchived})
+	if err != nil {
+		return nil, err
+	}
+	qr, err := s.FindQRCode(id)
+	if err != nil {
+		return nil, err
+	}
+	if qr.Status != status {
+		if err := s.store.SetStatus(id, status); err != nil {
+			return nil, err
+		}
+		updated := *qr
+		updated.Status = status
+		qr = &updated
+	}
+	return s.toResponse(qr)
 }
 
 // get qr code by url
@@ -134,16 +444,10 @@ func (s *QRService) GetQRCodeByURL(url string) (*models.QRCodeResponse, error) {
 	if qr == nil {
 		return nil, nil
 	}
-	return &models.QRCodeResponse{
-		ID:          qr.ID,
-		URL:         qr.URL,
-		QRCodeURL:   "/r/" + qr.ID,
-		CreatedAt:   qr.CreatedAt,
-		ExpiresAt:   qr.ExpiresAt,
-		ImageBase64: qr.ImageBase64,
-	}, nil
+	return s.toResponse(qr)
 }
 
-func (s *QRService) IncrementScanCount(id string) error {
+// count a scan of the code, false without counting once it has used up its max_scans
+func (s *QRService) IncrementScanCount(id string) (bool, error) {
 	return s.store.IncrementScanCount(id)
 }
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	minSlugLength = 3
+	maxSlugLength = 64
+
+	defaultIDLength = 16
+	minIDLength     = 6
+	maxIDLength     = 64
+	// new codes are retried with another random id when one is taken
+	maxIDAttempts = 5
+)
+
+// ErrIDTaken is returned when a code is saved under an id that is already in use
+var ErrIDTaken = errors.New("QR code ID is already taken")
+
+// alphabets QR_ID_ALPHABET can name, anything else is used as the alphabet itself
+var idAlphabets = map[string]string{
+	"hex":    "0123456789abcdef",
+	"base36": "0123456789abcdefghijklmnopqrstuvwxyz",
+	"base62": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// letters, digits, dashes and underscores, starting and ending with a letter or digit
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9_-]*[A-Za-z0-9])?$`)
+
+// characters a custom QR_ID_ALPHABET may use, the ones allowed in slugs
+var idCharsPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// slugs that look like our own pages or could be mistaken for them
+var reservedSlugs = map[string]bool{
+	"admin":      true,
+	"api":        true,
+	"decode":     true,
+	"expiration": true,
+	"fonts":      true,
+	"frames":     true,
+	"health":     true,
+	"login":      true,
+	"logos":      true,
+	"logout":     true,
+	"metrics":    true,
+	"qr":         true,
+	"r":          true,
+	"sheet":      true,
+	"signup":     true,
+	"static":     true,
+	// GET /v1/qr/trash would list the trash instead of the code
+	"trash": true,
+	"v1":    true,
+}
+
+func normalizeSlug(slug string) (string, error) {
+	slug = strings.TrimSpace(slug)
+	if len(slug) < minSlugLength || len(slug) > maxSlugLength {
+		return "", invalidf("slug must be between %d and %d characters", minSlugLength, maxSlugLength)
+	}
+	if !slugPattern.MatchString(slug) {
+		return "", invalidf("slug may only contain letters, digits, dashes and underscores, and must start and end with a letter or digit")
+	}
+	if reservedSlugs[strings.ToLower(slug)] {
+		return "", invalidf("slug %q is reserved", slug)
+	}
+	return slug, nil
+}
+
+// alphabet and length of random ids from QR_ID_ALPHABET and QR_ID_LENGTH. the
+// default 16 hex characters are what ids have always looked like
+func idFormat() (string, int) {
+	alphabet := os.Getenv("QR_ID_ALPHABET")
+	if named, ok := idAlphabets[strings.ToLower(alphabet)]; ok {
+		alphabet = named
+	} else if len(alphabet) < 2 || !idCharsPattern.MatchString(alphabet) {
+		alphabet = idAlphabets["hex"]
+	}
+
+	length := envInt("QR_ID_LENGTH", defaultIDLength)
+	if length < minIDLength || length > maxIDLength {
+		length = defaultIDLength
+	}
+	return alphabet, length
+}
+
+// give a new code its slug when one is asked for and a random id otherwise, then
+// render and save it. a taken slug is a conflict, a taken random id is drawn again
+func (s *QRService) createWithID(qr *models.QRCode, slug string) error {
+	if slug != "" {
+		// checked up front so a taken slug doesn't cost a render, the store
+		// still refuses duplicates that race past this
+		if existing, err := s.store.FindByID(slug); err == nil && existing != nil {
+			return ErrIDTaken
+		}
+		qr.ID = slug
+		return s.createQRCode(qr)
+	}
+	for attempt := 1; ; attempt++ {
+		id, err := generateID()
+		if err != nil {
+			return err
+		}
+		qr.ID = id
+		if err := s.createQRCode(qr); !errors.Is(err, ErrIDTaken) || attempt == maxIDAttempts {
+			return err
+		}
+	}
+}
+
+// a random id, every character drawn uniformly from the alphabet
+func generateID() (string, error) {
+	alphabet, length := idFormat()
+	max := big.NewInt(int64(len(alphabet)))
+	id := make([]byte, length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = alphabet[n.Int64()]
+	}
+	return string(id), nil
+}
@@ -1,36 +1,385 @@
 package services
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
 
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/skip2/go-qrcode"
 )
 
-func addTextBelow(img image.Image, text string) (image.Image, error) {
-	qrBounds := img.Bounds()
-	textHeight := 20
-	gap := 20
-	newHeight := qrBounds.Dy() + gap + textHeight
-	newImg := image.NewRGBA(image.Rect(0, 0, qrBounds.Dx(), newHeight))
+const (
+	FormatPNG  = "png"
+	FormatSVG  = "svg"
+	FormatJPEG = "jpeg"
+	FormatPDF  = "pdf"
+	FormatText = "txt"
+	// text drawn with plain ascii characters instead of block elements
+	FormatASCII = "ascii"
+)
 
-	draw.Draw(newImg, newImg.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
-	draw.Draw(newImg, qrBounds, img, image.Point{}, draw.Over)
+const (
+	qrImageSize  = 256
+	minImageSize = 64
+	maxImageSize = 2048
+	captionGap   = 20
+	jpegQuality  = 90
+)
+
+var contentTypes = map[string]string{
+	FormatPNG:   "image/png",
+	FormatSVG:   "image/svg+xml",
+	FormatJPEG:  "image/jpeg",
+	FormatPDF:   "application/pdf",
+	FormatText:  "text/plain; charset=utf-8",
+	FormatASCII: "text/plain; charset=utf-8",
+}
+
+// formats in the order they are matched against content types, the first one
+// wins when several share a type
+var formats = []string{FormatPNG, FormatSVG, FormatJPEG, FormatPDF, FormatText, FormatASCII}
+
+var fileExtensions = map[string]string{
+	FormatPNG:   "png",
+	FormatSVG:   "svg",
+	FormatJPEG:  "jpg",
+	FormatPDF:   "pdf",
+	FormatText:  "txt",
+	FormatASCII: "txt",
+}
+
+// content type served for an image format
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// file extension used when an image is downloaded
+func FileExtension(format string) string {
+	return fileExtensions[format]
+}
+
+// image format for a media type, empty if it is not one we render. parameters
+// like charset are ignored
+func FormatForContentType(contentType string) string {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	for _, format := range formats {
+		if strings.Split(contentTypes[format], ";")[0] == mediaType {
+			return format
+		}
+	}
+	return ""
+}
+
+func normalizeFormat(format string) (string, error) {
+	if format == "" {
+		return FormatPNG, nil
+	}
+	if _, ok := contentTypes[format]; !ok {
+		return "", invalidf("unsupported format %q", format)
+	}
+	return format, nil
+}
+
+func normalizeSize(size int) (int, error) {
+	if size == 0 {
+		return qrImageSize, nil
+	}
+	if size < minImageSize || size > maxImageSize {
+		return 0, invalidf("size must be between %d and %d", minImageSize, maxImageSize)
+	}
+	return size, nil
+}
+
+var recoveryLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+func normalizeErrorCorrection(level string) (string, error) {
+	if level == "" {
+		return "M", nil
+	}
+	level = strings.ToUpper(level)
+	if _, ok := recoveryLevels[level]; !ok {
+		return "", invalidf("error_correction must be one of L, M, Q or H")
+	}
+	return level, nil
+}
+
+// validate render options and fill in the defaults for anything unset
+func normalizeOptions(opts models.RenderOptions) (models.RenderOptions, error) {
+	var err error
+	if opts.Format, err = normalizeFormat(opts.Format); err != nil {
+		return opts, err
+	}
+	if opts.ErrorCorrection, err = normalizeErrorCorrection(opts.ErrorCorrection); err != nil {
+		return opts, err
+	}
+	// the logo hides part of the code, only the highest level recovers from that
+	if opts.LogoID != "" {
+		opts.ErrorCorrection = "H"
+	}
+	if err := normalizePrint(&opts); err != nil {
+		return opts, err
+	}
+	if opts.SizePx == 0 {
+		if opts.WidthMM == 0 {
+			opts.SizePx = qrImageSize
+		}
+	} else if opts.SizePx < minImageSize || opts.SizePx > maxImageSize {
+		return opts, invalidf("size_px must be between %d and %d", minImageSize, maxImageSize)
+	}
+	if opts.ForegroundColor, err = normalizeColor(opts.ForegroundColor, defaultForeground); err != nil {
+		return opts, err
+	}
+	if opts.BackgroundColor, err = normalizeColor(opts.BackgroundColor, defaultBackground); err != nil {
+		return opts, err
+	}
+	if err := normalizeStyles(&opts); err != nil {
+		return opts, err
+	}
+	if err := normalizeCaption(&opts); err != nil {
+		return opts, err
+	}
+	if err := normalizeFrame(&opts); err != nil {
+		return opts, err
+	}
+	// a transparent code is still checked against the background it is meant to be printed on
+	fg, bg := renderColors(opts)
+	bg.A = 0xff
+	if err := checkContrast(fg, bg); err != nil {
+		return opts, err
+	}
+	if opts.FinderColor != opts.ForegroundColor {
+		finder, _ := parseHexColor(opts.FinderColor)
+		if err := checkContrast(finder, bg); err != nil {
+			return opts, err
+		}
+	}
+	// frames run along the quiet zone, a light one reads as part of it
+	if opts.Frame != "" {
+		frame, _ := parseHexColor(opts.FrameColor)
+		if err := checkContrast(frame, bg); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// module and background colors for normalized options. jpeg has no alpha channel
+// so it always gets the opaque background
+func renderColors(opts models.RenderOptions) (fg, bg color.NRGBA) {
+	fg, _ = parseHexColor(opts.ForegroundColor)
+	bg, _ = parseHexColor(opts.BackgroundColor)
+	if opts.Transparent && opts.Format != FormatJPEG {
+		bg.A = 0
+	}
+	return fg, bg
+}
+
+func renderOptionsFromRequest(req *models.QRCodeRequest) (models.RenderOptions, error) {
+	return normalizeOptions(models.RenderOptions{
+		Format:          req.Format,
+		ErrorCorrection: req.ErrorCorrection,
+		SizePx:          req.SizePx,
+		ForegroundColor: req.ForegroundColor,
+		BackgroundColor: req.BackgroundColor,
+		Transparent:     req.Transparent,
+		ModuleStyle:     req.ModuleStyle,
+		FinderStyle:     req.FinderStyle,
+		FinderColor:     req.FinderColor,
+		LogoID:          req.LogoID,
+		Caption:         req.Caption,
+		HideCaption:     req.HideCaption,
+		Font:            req.Font,
+		FontSize:        req.FontSize,
+		Frame:           req.Frame,
+		FrameColor:      req.FrameColor,
+		FrameText:       req.FrameText,
+		WidthMM:         req.WidthMM,
+		DPI:             req.DPI,
+	})
+}
+
+// everything needed to draw one qr code, shared by the raster and svg renderers
+type qrDrawing struct {
+	bitmap  [][]bool
+	size    int // of the modules, without the quiet zone
+	quiet   int // quiet zone in pixels, only print sized codes have one
+	dpi     float64
+	caption *captionLayout // nil without a caption
+	fg, bg  color.NRGBA
+	logo    *models.Logo
+	logoBox image.Rectangle // in modules, empty without a logo
+
+	moduleStyle, finderStyle string
+	finderColor              color.NRGBA
+
+	frame       Frame // nil without a frame
+	frameParams FrameParams
+}
+
+// the url encoded in the code of id
+func redirectURL(id string) string {
+	return os.Getenv("FRONTEND_URL") + "/r/" + id
+}
 
-	col := color.Black
-	point := fixed.Point26_6{
-		X: fixed.I((qrBounds.Dx() - len(text)*7) / 2),
-		Y: fixed.I(qrBounds.Dy() + gap + 15),
+// lay out the qr code pointing at the redirect url of id, opts must be normalized.
+// logo is the one referenced by opts.LogoID
+func newDrawing(id string, opts models.RenderOptions, logo *models.Logo) (*qrDrawing, error) {
+	qrImg, err := qrcode.New(redirectURL(id), recoveryLevels[opts.ErrorCorrection])
+	if err != nil {
+		return nil, err
 	}
-	d := &font.Drawer{
-		Dst:  newImg,
-		Src:  image.NewUniform(col),
-		Face: basicfont.Face7x13,
-		Dot:  point,
+	qrImg.DisableBorder = true
+
+	fg, bg := renderColors(opts)
+	finder, _ := parseHexColor(opts.FinderColor)
+
+	bitmap := qrImg.Bitmap()
+	size, quiet, dpi := opts.SizePx, 0, float64(opts.DPI)
+	if opts.WidthMM != 0 {
+		px := printModulePixels(opts, len(bitmap))
+		size, quiet = px*len(bitmap), px*quietZoneModules
+		dpi = printDPI(size+2*quiet, opts.WidthMM)
+	}
+
+	caption, err := layoutCaption(captionText(id, opts), opts, size+2*quiet)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &qrDrawing{
+		bitmap:  bitmap,
+		size:    size,
+		quiet:   quiet,
+		dpi:     dpi,
+		caption: caption,
+		fg:      fg,
+		bg:      bg,
+		logo:    logo,
+
+		moduleStyle: opts.ModuleStyle,
+		finderStyle: opts.FinderStyle,
+		finderColor: finder,
+	}
+	if logo != nil {
+		d.logoBox = logoBox(len(d.bitmap))
+	}
+	if opts.Frame != "" {
+		d.frame, _ = findFrame(opts.Frame)
+		if d.frameParams, err = frameParams(opts, bg); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// size of the code with its quiet zone
+func (d *qrDrawing) blockSize() int {
+	return d.size + 2*d.quiet
+}
+
+// size of the whole image, where the code and its caption sit inside it and the
+// frame shapes drawn behind them
+func (d *qrDrawing) canvas() (image.Point, image.Point, []Shape, error) {
+	content := image.Pt(d.blockSize(), d.blockSize())
+	if d.caption != nil {
+		content.Y += captionGap + d.caption.height
+	}
+	if d.frame == nil {
+		return content, image.Point{}, nil, nil
+	}
+	return d.frameLayout(content)
+}
+
+// render the qr code pointing at the redirect url of id in opts.Format
+func renderQRCode(id string, opts models.RenderOptions, logo *models.Logo) ([]byte, error) {
+	d, err := newDrawing(id, opts, logo)
+	if err != nil {
+		return nil, err
 	}
-	d.DrawString(text)
+
+	switch opts.Format {
+	case FormatSVG:
+		return renderSVG(d)
+	case FormatPDF:
+		return renderPDF(d)
+	case FormatText, FormatASCII:
+		return renderText(d, opts.Format == FormatASCII), nil
+	}
+
+	var img image.Image = drawModules(d)
+	if logo != nil {
+		if img, err = drawLogo(img, d); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.quiet > 0 {
+		img = addQuietZone(img, d)
+	}
+
+	// Add the caption as text below the QR code
+	imgWithText, err := addTextBelow(img, d.caption, d.fg, d.bg)
+	if err != nil {
+		return nil, err
+	}
+	if d.frame != nil {
+		if imgWithText, err = drawFrame(imgWithText, d); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if opts.Format == FormatJPEG {
+		if err := jpeg.Encode(&buf, imgWithText, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		return withJPEGDensity(buf.Bytes(), d.dpi), nil
+	}
+	if err := png.Encode(&buf, imgWithText); err != nil {
+		return nil, err
+	}
+	return withPNGDensity(buf.Bytes(), d.dpi), nil
+}
+
+// surround the code with its quiet zone in the background color
+func addQuietZone(img image.Image, d *qrDrawing) image.Image {
+	out := image.NewNRGBA(image.Rect(0, 0, d.blockSize(), d.blockSize()))
+	draw.Draw(out, out.Bounds(), image.NewUniform(d.bg), image.Point{}, draw.Src)
+	draw.Draw(out, img.Bounds().Add(image.Pt(d.quiet, d.quiet)), img, img.Bounds().Min, draw.Src)
+	return out
+}
+
+// first pixel of module m when the code is scaled to size, matching how
+// go-qrcode maps pixels to modules
+func modulePixel(m, modules, size int) int {
+	return (m*size + modules - 1) / modules
+}
+
+func addTextBelow(img image.Image, caption *captionLayout, fg, bg color.Color) (image.Image, error) {
+	if caption == nil {
+		return img, nil
+	}
+
+	qrBounds := img.Bounds()
+	newHeight := qrBounds.Dy() + captionGap + caption.height
+	newImg := image.NewNRGBA(image.Rect(0, 0, qrBounds.Dx(), newHeight))
+
+	draw.Draw(newImg, newImg.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+	draw.Draw(newImg, qrBounds, img, image.Point{}, draw.Over)
+
+	mask := caption.mask(qrBounds.Dx())
+	offset := image.Pt(0, qrBounds.Dy()+captionGap)
+	draw.DrawMask(newImg, mask.Bounds().Add(offset), image.NewUniform(fg), image.Point{}, mask, image.Point{}, draw.Over)
 	return newImg, nil
 }
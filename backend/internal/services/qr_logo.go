@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/draw"
+	"time"
+
+	"github.com/phucnguyen/qrify/internal/models"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	MaxLogoBytes     = 1 << 20
+	maxLogoDimension = 2048
+
+	// share of the code width the logo box may cover. that is about 6% of the
+	// modules, well inside what high error correction can recover
+	maxLogoRatio = 0.25
+)
+
+// validate and store an uploaded logo. logos are content addressed so uploading
+// the same image again returns the existing one
+func (s *QRService) UploadLogo(data []byte) (*models.Logo, error) {
+	if len(data) == 0 {
+		return nil, invalidf("logo is empty")
+	}
+	if len(data) > MaxLogoBytes {
+		return nil, invalidf("logo must be at most %d bytes", MaxLogoBytes)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return nil, invalidf("logo must be a PNG or JPEG image")
+	}
+	if cfg.Width > maxLogoDimension || cfg.Height > maxLogoDimension {
+		return nil, invalidf("logo must be at most %dx%d pixels", maxLogoDimension, maxLogoDimension)
+	}
+
+	sum := sha256.Sum256(data)
+	logo := &models.Logo{
+		ID:          hex.EncodeToString(sum[:16]),
+		ContentType: "image/" + format,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+		CreatedAt:   time.Now(),
+		Data:        data,
+	}
+	if err := s.store.SaveLogo(logo); err != nil {
+		return nil, err
+	}
+	return s.GetLogo(logo.ID)
+}
+
+// get logo by id
+func (s *QRService) GetLogo(id string) (*models.Logo, error) {
+	logo, err := s.store.FindLogo(id)
+	if err != nil {
+		return nil, err
+	}
+	if logo == nil {
+		return nil, errors.New("logo not found")
+	}
+	return logo, nil
+}
+
+// logo referenced by the render options, nil if there is none
+func (s *QRService) findLogo(opts models.RenderOptions) (*models.Logo, error) {
+	if opts.LogoID == "" {
+		return nil, nil
+	}
+	logo, err := s.store.FindLogo(opts.LogoID)
+	if err != nil {
+		return nil, err
+	}
+	if logo == nil {
+		return nil, invalidf("logo %s not found", opts.LogoID)
+	}
+	return logo, nil
+}
+
+// centered square of modules cleared for the logo. it has the same parity as the
+// code so it sits exactly in the middle
+func logoBox(modules int) image.Rectangle {
+	n := int(float64(modules) * maxLogoRatio)
+	if n%2 != modules%2 {
+		n--
+	}
+	start := (modules - n) / 2
+	return image.Rect(start, start, start+n, start+n)
+}
+
+// the cleared logo box in pixels
+func logoPixelBox(d *qrDrawing) image.Rectangle {
+	modules := len(d.bitmap)
+	return image.Rect(
+		modulePixel(d.logoBox.Min.X, modules, d.size),
+		modulePixel(d.logoBox.Min.Y, modules, d.size),
+		modulePixel(d.logoBox.Max.X, modules, d.size),
+		modulePixel(d.logoBox.Max.Y, modules, d.size),
+	)
+}
+
+// pixel rectangle the logo image is drawn into, inset from the cleared box
+func logoRect(d *qrDrawing) image.Rectangle {
+	box := logoPixelBox(d)
+	return box.Inset(box.Dx() / 12)
+}
+
+// clear the logo box to the background and draw the logo into it, keeping its aspect ratio
+func drawLogo(img image.Image, d *qrDrawing) (image.Image, error) {
+	logoImg, _, err := image.Decode(bytes.NewReader(d.logo.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	out := image.NewNRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	draw.Draw(out, logoPixelBox(d), image.NewUniform(d.bg), image.Point{}, draw.Src)
+
+	xdraw.CatmullRom.Scale(out, fitRect(logoRect(d), logoImg.Bounds()), logoImg, logoImg.Bounds(), xdraw.Over, nil)
+	return out, nil
+}
+
+// largest rectangle with the aspect ratio of src centered inside dst
+func fitRect(dst, src image.Rectangle) image.Rectangle {
+	w, h := dst.Dx(), dst.Dy()
+	if src.Dx()*h > src.Dy()*w {
+		h = src.Dy() * w / src.Dx()
+	} else {
+		w = src.Dx() * h / src.Dy()
+	}
+	min := dst.Min.Add(image.Pt((dst.Dx()-w)/2, (dst.Dy()-h)/2))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(w, h))}
+}
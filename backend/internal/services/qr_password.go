@@ -0,0 +1,203 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/phucnguyen/qrify/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 4
+	// bcrypt ignores everything past this many bytes
+	maxPasswordLength = 72
+
+	defaultUnlockAttempts  = 5
+	defaultUnlockWindowSec = 15 * 60
+	// past this many tracked addresses old entries are swept on the next failure
+	maxTrackedAddresses = 10000
+
+	// how long the password prompt of a counted scan can be answered
+	unlockTokenTTL = 10 * time.Minute
+)
+
+var (
+	ErrWrongPassword   = errors.New("wrong password")
+	ErrTooManyAttempts = errors.New("too many attempts, try again later")
+	// the prompt wasn't shown for a counted scan, or was answered already or too late
+	ErrUnlockExpired = errors.New("the password prompt expired, scan the code again")
+)
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", invalidf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// failed unlock attempts per client address over a sliding window. kept in
+// memory, a restart forgets them
+type attemptLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	failures map[string][]time.Time
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{limit: limit, window: window, failures: map[string][]time.Time{}}
+}
+
+// failures of ip still inside the window, dropping older ones
+func (l *attemptLimiter) recent(ip string, now time.Time) []time.Time {
+	times := l.failures[ip]
+	for len(times) > 0 && now.Sub(times[0]) >= l.window {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(l.failures, ip)
+		return nil
+	}
+	l.failures[ip] = times
+	return times
+}
+
+func (l *attemptLimiter) allowed(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.recent(ip, now)) < l.limit
+}
+
+func (l *attemptLimiter) fail(ip string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.failures) > maxTrackedAddresses {
+		for other := range l.failures {
+			l.recent(other, now)
+		}
+	}
+	l.failures[ip] = append(l.recent(ip, now), now)
+}
+
+// tokens handed out with the password prompt of a counted scan. an unlock needs
+// one, so every unlock has its scan counted against max_scans. each token unlocks
+// once and the secret lives in memory, a restart voids open prompts
+type unlockTokens struct {
+	mu     sync.Mutex
+	secret []byte
+	// tokens already used, until they expire
+	used map[string]time.Time
+}
+
+func newUnlockTokens() *unlockTokens {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return &unlockTokens{secret: secret, used: map[string]time.Time{}}
+}
+
+func (t *unlockTokens) mac(id string, payload []byte) []byte {
+	m := hmac.New(sha256.New, t.secret)
+	m.Write([]byte(id))
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+// a token for the code that expires after unlockTokenTTL
+func (t *unlockTokens) issue(id string, now time.Time) string {
+	// expiry then a random nonce, so tokens issued at the same time differ
+	payload := make([]byte, 8+12)
+	binary.BigEndian.PutUint64(payload, uint64(now.Add(unlockTokenTTL).Unix()))
+	if _, err := rand.Read(payload[8:]); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, t.mac(id, payload)...))
+}
+
+// the token's expiry when it was issued for the code and hasn't run out
+func (t *unlockTokens) check(id, token string, now time.Time) (time.Time, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 8+12+sha256.Size {
+		return time.Time{}, false
+	}
+	payload, sum := raw[:20], raw[20:]
+	if !hmac.Equal(sum, t.mac(id, payload)) {
+		return time.Time{}, false
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	return expires, now.Before(expires)
+}
+
+// whether the token can still unlock the code, without using it up
+func (t *unlockTokens) valid(id, token string, now time.Time) bool {
+	if _, ok := t.check(id, token, now); !ok {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, used := t.used[token]
+	return !used
+}
+
+// use the token up, false when it was not valid or another request used it first
+func (t *unlockTokens) use(id, token string, now time.Time) bool {
+	expires, ok := t.check(id, token, now)
+	if !ok {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for other, exp := range t.used {
+		if !now.Before(exp) {
+			delete(t.used, other)
+		}
+	}
+	if _, used := t.used[token]; used {
+		return false
+	}
+	t.used[token] = expires
+	return true
+}
+
+// a token for the password prompt of a scan of the code that was just counted
+func (s *QRService) UnlockToken(id string) string {
+	return s.tokens.issue(id, time.Now())
+}
+
+// check the password of a protected code for a scanner at ip, answering the
+// prompt that came with token. wrong guesses count against ip, once it has too
+// many it is refused until they age out. other scanners of the code aren't held
+// back by it
+func (s *QRService) UnlockQRCode(qr *models.QRCode, password, token, ip string) error {
+	now := time.Now()
+	if !s.tokens.valid(qr.ID, token, now) {
+		return ErrUnlockExpired
+	}
+	if !s.unlocks.allowed(ip, now) {
+		return ErrTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(qr.PasswordHash), []byte(password)) != nil {
+		s.unlocks.fail(ip, now)
+		return ErrWrongPassword
+	}
+	if !s.tokens.use(qr.ID, token, now) {
+		return ErrUnlockExpired
+	}
+	return nil
+}
+
+func (s *QRService) IncrementUnlockCount(id string) error {
+	return s.store.IncrementUnlockCount(id)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// pdfs carry a fixed date so the same code always renders to the same bytes,
+// which keeps etags stable across restarts
+var pdfDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newPDF(unit string, size fpdf.SizeType) *fpdf.Fpdf {
+	pdf := fpdf.NewCustom(&fpdf.InitType{UnitStr: unit, Size: size})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCreationDate(pdfDate)
+	pdf.SetModificationDate(pdfDate)
+	pdf.SetProducer("QRify", true)
+	return pdf
+}
+
+// a single code on a page of its own size. pixels are points unless a dpi is set
+func renderPDF(d *qrDrawing) ([]byte, error) {
+	canvas, _, _, err := d.canvas()
+	if err != nil {
+		return nil, err
+	}
+
+	scale := 1.0
+	if d.dpi != 0 {
+		scale = pointsPerInch / d.dpi
+	}
+	pdf := newPDF("pt", fpdf.SizeType{Wd: float64(canvas.X) * scale, Ht: float64(canvas.Y) * scale})
+	pdf.AddPage()
+	if err := drawPDF(pdf, d, 0, 0, scale); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// draw the code with its caption and frame as vectors, with the top left corner at
+// x, y. scale converts image pixels to pdf units
+func drawPDF(pdf *fpdf.Fpdf, d *qrDrawing, x, y, scale float64) error {
+	canvas, offset, shapes, err := d.canvas()
+	if err != nil {
+		return err
+	}
+	fill := func(p *Path, c color.NRGBA, dx, dy float64) {
+		if len(p.cmds) == 0 {
+			return
+		}
+		pdf.SetFillColor(int(c.R), int(c.G), int(c.B))
+		p.writePDF(pdf, x+dx*scale, y+dy*scale, scale)
+		pdf.DrawPath("F")
+	}
+
+	if d.bg.A != 0 {
+		pdf.SetFillColor(int(d.bg.R), int(d.bg.G), int(d.bg.B))
+		pdf.Rect(x, y, float64(canvas.X)*scale, float64(canvas.Y)*scale, "F")
+	}
+	for _, shape := range shapes {
+		fill(shape.Path, shape.Color, 0, 0)
+	}
+
+	// the caption sits below the quiet zone, everything else inside it
+	cx, cy := float64(offset.X), float64(offset.Y)
+	ox, oy := cx+float64(d.quiet), cy+float64(d.quiet)
+	fill(d.modulesPath(), d.fg, ox, oy)
+	if finder := d.finderPath(); finder != nil {
+		fill(finder, d.finderColor, ox, oy)
+	}
+
+	if d.logo != nil {
+		name := "logo-" + d.logo.ID
+		options := fpdf.ImageOptions{ImageType: strings.TrimPrefix(d.logo.ContentType, "image/")}
+		pdf.RegisterImageOptionsReader(name, options, bytes.NewReader(d.logo.Data))
+		r := fitRect(logoRect(d), image.Rect(0, 0, d.logo.Width, d.logo.Height))
+		pdf.ImageOptions(name, x+(ox+float64(r.Min.X))*scale, y+(oy+float64(r.Min.Y))*scale,
+			float64(r.Dx())*scale, float64(r.Dy())*scale, false, options, 0, "")
+	}
+
+	if d.caption != nil {
+		p, err := d.caption.path(d.blockSize())
+		if err != nil {
+			return err
+		}
+		fill(p, d.fg, cx, cy+float64(d.blockSize()+captionGap))
+	}
+	return pdf.Error()
+}
+
+// add the path to the current pdf path, scaled and moved to x0, y0
+func (p *Path) writePDF(pdf *fpdf.Fpdf, x0, y0, scale float64) {
+	pt := func(x, y float32) (float64, float64) {
+		return x0 + float64(x)*scale, y0 + float64(y)*scale
+	}
+	for _, cmd := range p.cmds {
+		a := cmd.args
+		switch cmd.op {
+		case opMoveTo:
+			pdf.MoveTo(pt(a[0], a[1]))
+		case opLineTo:
+			pdf.LineTo(pt(a[0], a[1]))
+		case opQuadTo:
+			cx, cy := pt(a[0], a[1])
+			x, y := pt(a[2], a[3])
+			pdf.CurveTo(cx, cy, x, y)
+		case opCubeTo:
+			cx0, cy0 := pt(a[0], a[1])
+			cx1, cy1 := pt(a[2], a[3])
+			x, y := pt(a[4], a[5])
+			pdf.CurveBezierCubicTo(cx0, cy0, cx1, cy1, x, y)
+		case opClose:
+			pdf.ClosePath()
+		}
+	}
+}
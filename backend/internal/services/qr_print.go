@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"strconv"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	defaultDPI = 300
+	minDPI     = 72
+	maxDPI     = 2400
+	minWidthMM = 5
+	maxWidthMM = 2000
+	// largest print image we render, about 68cm at 300 dpi
+	maxPrintPixels = 8000
+	// the quiet zone the qr spec asks for, in modules
+	quietZoneModules = 4
+	// points per inch, pdf and caption font sizes are measured in points
+	pointsPerInch = 72
+	mmPerInch     = 25.4
+)
+
+// validate the physical size options. a width in millimeters switches to print
+// sizing, size_px is worked out from the module count at render time instead
+func normalizePrint(opts *models.RenderOptions) error {
+	if opts.DPI == 0 && opts.WidthMM == 0 {
+		return nil
+	}
+	if opts.DPI == 0 {
+		opts.DPI = defaultDPI
+	} else if opts.DPI < minDPI || opts.DPI > maxDPI {
+		return invalidf("dpi must be between %d and %d", minDPI, maxDPI)
+	}
+	if opts.WidthMM == 0 {
+		return nil
+	}
+	if opts.SizePx != 0 {
+		return invalidf("size_px and width_mm can't both be set")
+	}
+	if math.IsNaN(opts.WidthMM) || opts.WidthMM < minWidthMM || opts.WidthMM > maxWidthMM {
+		return invalidf("width_mm must be between %d and %d", minWidthMM, maxWidthMM)
+	}
+	if mmToPixels(opts.WidthMM, opts.DPI) > maxPrintPixels {
+		return invalidf("width_mm at %d dpi would be more than %d pixels wide", opts.DPI, maxPrintPixels)
+	}
+	return nil
+}
+
+func mmToPixels(mm float64, dpi int) float64 {
+	return mm / mmPerInch * float64(dpi)
+}
+
+// a length in pixels as an svg length in millimeters
+func pixelsToMM(px int, dpi float64) string {
+	return strconv.FormatFloat(float64(px)*mmPerInch/dpi, 'f', 2, 64) + "mm"
+}
+
+// whole pixels per module so that the code and its quiet zone come as close to
+// the printed width as possible. whole pixels keep every module the same size,
+// printers and scanners both cope badly with resampled modules
+func printModulePixels(opts models.RenderOptions, modules int) int {
+	px := int(math.Round(mmToPixels(opts.WidthMM, opts.DPI) / float64(modules+2*quietZoneModules)))
+	if px < 1 {
+		px = 1
+	}
+	return px
+}
+
+// the density that prints px pixels exactly widthMM wide. rounding the modules to
+// whole pixels moves the code off the requested dpi a little, the density written
+// into the image follows it so the printed width stays width_mm
+func printDPI(px int, widthMM float64) float64 {
+	return float64(px) / widthMM * mmPerInch
+}
+
+// add a pHYs chunk after the header so print software sizes the png correctly
+func withPNGDensity(data []byte, dpi float64) []byte {
+	// the signature is 8 bytes and the IHDR chunk always 25
+	const headerEnd = 8 + 25
+	if dpi == 0 || len(data) < headerEnd {
+		return data
+	}
+	ppm := uint32(math.Round(dpi / mmPerInch * 1000))
+
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk, 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1 // the unit is meters
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	var buf bytes.Buffer
+	buf.Write(data[:headerEnd])
+	buf.Write(chunk)
+	buf.Write(data[headerEnd:])
+	return buf.Bytes()
+}
+
+// add a jfif segment with the density after the start of image marker, the go
+// encoder writes none
+func withJPEGDensity(data []byte, dpi float64) []byte {
+	if dpi == 0 || len(data) < 2 {
+		return data
+	}
+	// jfif only holds whole dots per inch
+	dots := int(math.Round(dpi))
+	segment := []byte{
+		0xff, 0xe0, 0, 16,
+		'J', 'F', 'I', 'F', 0,
+		1, 2, // version 1.2
+		1, // the unit is dots per inch
+		byte(dots >> 8), byte(dots), byte(dots >> 8), byte(dots),
+		0, 0, // no thumbnail
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:2])
+	buf.Write(segment)
+	buf.Write(data[2:])
+	return buf.Bytes()
+}
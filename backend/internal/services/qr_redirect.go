@@ -0,0 +1,129 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const maxRedirectRules = 20
+
+// Visitor is who scanned a code, redirects are decided on it
+type Visitor struct {
+	UserAgent string
+	// client address, looked up in the GeoIP database for country rules
+	IP string
+	// split variant remembered from an earlier scan
+	Variant string
+	// query of the scanned url, forwarded when the code asks for it
+	Query url.Values
+}
+
+// Redirect is where a scan is sent
+type Redirect struct {
+	URL string
+	// split variant the scan got, empty when the url didn't come from a split
+	Variant string
+	// whether the variant should be remembered for the next scan
+	Sticky bool
+}
+
+func oneOf(value, field string, allowed []string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, a := range allowed {
+		if a == value {
+			return value, nil
+		}
+	}
+	return "", invalidf("%s must be one of %s", field, strings.Join(allowed, ", "))
+}
+
+func normalizeRedirectRules(rules models.RedirectRules) (models.RedirectRules, error) {
+	if len(rules) > maxRedirectRules {
+		return nil, invalidf("a code can have at most %d redirect rules", maxRedirectRules)
+	}
+	out := make(models.RedirectRules, 0, len(rules))
+	for i, rule := range rules {
+		var err error
+		if rule.OS == "" && rule.Device == "" && len(rule.Countries) == 0 {
+			return nil, invalidf("redirect rule %d must set os, device or countries", i+1)
+		}
+		if rule.OS != "" {
+			if rule.OS, err = oneOf(rule.OS, "os", operatingSystems); err != nil {
+				return nil, err
+			}
+		}
+		if rule.Device != "" {
+			if rule.Device, err = oneOf(rule.Device, "device", devices); err != nil {
+				return nil, err
+			}
+		}
+		countries := make([]string, 0, len(rule.Countries))
+		for _, country := range rule.Countries {
+			country = strings.ToUpper(strings.TrimSpace(country))
+			if !countryCodePattern.MatchString(country) {
+				return nil, invalidf("country %q must be a two letter ISO 3166 code like DE", country)
+			}
+			countries = append(countries, country)
+		}
+		rule.Countries = nil
+		if len(countries) > 0 {
+			rule.Countries = countries
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+// what rules are matched against, the country is only looked up when a rule asks for it
+type ruleTarget struct {
+	ua      userAgent
+	ip      string
+	country *string
+}
+
+func (t *ruleTarget) matches(rule models.RedirectRule) bool {
+	if (rule.OS != "" && rule.OS != t.ua.os) || (rule.Device != "" && rule.Device != t.ua.device) {
+		return false
+	}
+	if len(rule.Countries) == 0 {
+		return true
+	}
+	if t.country == nil {
+		country := countryOf(t.ip)
+		t.country = &country
+	}
+	for _, c := range rule.Countries {
+		if c == *t.country {
+			return true
+		}
+	}
+	return false
+}
+
+// where a scan by v is sent: the first rule it matches, then the schedule window
+// covering the current time, then a variant of the split, the code's url otherwise.
+// tracking parameters are added to whichever it is
+func (s *QRService) Destination(qr *models.QRCode, v Visitor) Redirect {
+	redirect := destination(qr, v)
+	redirect.URL = withTracking(redirect.URL, qr, v, redirect.Variant)
+	return redirect
+}
+
+func destination(qr *models.QRCode, v Visitor) Redirect {
+	target := &ruleTarget{ua: parseUserAgent(v.UserAgent), ip: v.IP}
+	for _, rule := range qr.RedirectRules {
+		if target.matches(rule) {
+			return Redirect{URL: rule.URL}
+		}
+	}
+	if url, ok := scheduledURL(qr.Schedule, time.Now()); ok {
+		return Redirect{URL: url}
+	}
+	if variant, ok := pickVariant(qr.Split, v.Variant); ok {
+		return Redirect{URL: variant.URL, Variant: variant.Name, Sticky: qr.Split.Sticky}
+	}
+	return Redirect{URL: qr.URL}
+}
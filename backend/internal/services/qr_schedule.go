@@ -0,0 +1,132 @@
+package services
+
+import (
+	"sort"
+	"time"
+	// schedules name their timezone, the database is compiled in so they work on
+	// images without zoneinfo
+	_ "time/tzdata"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	maxScheduleWindows = 50
+	// how window times are stored, in the schedule's timezone
+	scheduleTimeLayout = "2006-01-02T15:04:05"
+)
+
+// layouts accepted for window times. times with an offset are converted to the
+// schedule's timezone
+var scheduleInputLayouts = []string{time.RFC3339, scheduleTimeLayout, "2006-01-02T15:04", "2006-01-02"}
+
+func parseScheduleTime(value string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range scheduleInputLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.In(loc), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// a window resolved to instants, zero times are open sides
+type scheduleSpan struct {
+	start, end time.Time
+	window     models.ScheduleWindow
+}
+
+func (s scheduleSpan) contains(t time.Time) bool {
+	return (s.start.IsZero() || !t.Before(s.start)) && (s.end.IsZero() || t.Before(s.end))
+}
+
+// the windows of a schedule as instants in the order given
+func scheduleSpans(schedule models.Schedule) ([]scheduleSpan, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, invalidf("unknown timezone %q", schedule.Timezone)
+	}
+	spans := make([]scheduleSpan, 0, len(schedule.Windows))
+	for i, w := range schedule.Windows {
+		span := scheduleSpan{window: w}
+		var ok bool
+		if w.Start != "" {
+			if span.start, ok = parseScheduleTime(w.Start, loc); !ok {
+				return nil, invalidf("schedule window %d has an invalid start %q, use a time like 2006-01-02T15:04:05", i+1, w.Start)
+			}
+			span.window.Start = span.start.Format(scheduleTimeLayout)
+		}
+		if w.End != "" {
+			if span.end, ok = parseScheduleTime(w.End, loc); !ok {
+				return nil, invalidf("schedule window %d has an invalid end %q, use a time like 2006-01-02T15:04:05", i+1, w.End)
+			}
+			span.window.End = span.end.Format(scheduleTimeLayout)
+		}
+		spans = append(spans, span)
+	}
+	return spans, nil
+}
+
+// check a schedule and store its windows in order of their start, with times
+// in the schedule's timezone. windows may not overlap
+func normalizeSchedule(schedule models.Schedule) (models.Schedule, error) {
+	if len(schedule.Windows) == 0 {
+		return models.Schedule{}, nil
+	}
+	if len(schedule.Windows) > maxScheduleWindows {
+		return models.Schedule{}, invalidf("a schedule can have at most %d windows", maxScheduleWindows)
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	spans, err := scheduleSpans(schedule)
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	for i, span := range spans {
+		if !span.start.IsZero() && !span.end.IsZero() && !span.start.Before(span.end) {
+			return models.Schedule{}, invalidf("schedule window %d must end after it starts", i+1)
+		}
+	}
+
+	// an open start sorts first, then windows can only overlap their neighbour
+	sort.SliceStable(spans, func(i, j int) bool {
+		return !spans[j].start.IsZero() && (spans[i].start.IsZero() || spans[i].start.Before(spans[j].start))
+	})
+	for i := 1; i < len(spans); i++ {
+		prev, next := spans[i-1], spans[i]
+		if prev.end.IsZero() || next.start.IsZero() || next.start.Before(prev.end) {
+			return models.Schedule{}, invalidf("schedule windows %s to %s and %s to %s overlap",
+				openTime(prev.window.Start), openTime(prev.window.End), openTime(next.window.Start), openTime(next.window.End))
+		}
+	}
+
+	out := models.Schedule{Timezone: schedule.Timezone}
+	for _, span := range spans {
+		out.Windows = append(out.Windows, span.window)
+	}
+	return out, nil
+}
+
+func openTime(t string) string {
+	if t == "" {
+		return "open"
+	}
+	return t
+}
+
+// the url of the window covering t, if any
+func scheduledURL(schedule models.Schedule, t time.Time) (string, bool) {
+	if len(schedule.Windows) == 0 {
+		return "", false
+	}
+	spans, err := scheduleSpans(schedule)
+	if err != nil {
+		return "", false
+	}
+	for _, span := range spans {
+		if span.contains(t) {
+			return span.window.URL, true
+		}
+	}
+	return "", false
+}
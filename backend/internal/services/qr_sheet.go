@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	maxSheetCodes  = 1000
+	maxSheetLabels = 200
+)
+
+// page sizes in millimeters. these and custom are the page_size values accepted
+var pageSizes = map[string]fpdf.SizeType{
+	"a4":     {Wd: 210, Ht: 297},
+	"a5":     {Wd: 148, Ht: 210},
+	"letter": {Wd: 215.9, Ht: 279.4},
+	"legal":  {Wd: 215.9, Ht: 355.6},
+}
+
+func pageSizeNames() []string {
+	names := make([]string, 0, len(pageSizes))
+	for name := range pageSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// a label in millimeters from the top left of the page
+type labelCell struct {
+	x, y, w, h float64
+}
+
+// validate a label template and work out the page size and label cells
+func sheetLayout(t models.LabelTemplate) (fpdf.SizeType, []labelCell, error) {
+	var page fpdf.SizeType
+	name := strings.ToLower(t.PageSize)
+	if name == "" {
+		// a4 unless a page size is given
+		name = "a4"
+		if t.PageWidthMM != 0 || t.PageHeightMM != 0 {
+			name = "custom"
+		}
+	}
+	if name == "custom" {
+		if t.PageWidthMM <= 0 || t.PageHeightMM <= 0 {
+			return page, nil, invalidf("a custom page needs page_width_mm and page_height_mm")
+		}
+		page = fpdf.SizeType{Wd: t.PageWidthMM, Ht: t.PageHeightMM}
+	} else {
+		size, ok := pageSizes[name]
+		if !ok {
+			return page, nil, invalidf("unknown page_size %q, use %s or custom", t.PageSize, strings.Join(pageSizeNames(), ", "))
+		}
+		page = size
+	}
+
+	if t.Rows < 1 || t.Columns < 1 {
+		return page, nil, invalidf("rows and columns must be at least 1")
+	}
+	if t.Rows*t.Columns > maxSheetLabels {
+		return page, nil, invalidf("a sheet can have at most %d labels", maxSheetLabels)
+	}
+	for _, v := range []float64{t.MarginTopMM, t.MarginBottomMM, t.MarginLeftMM, t.MarginRightMM, t.ColumnGapMM, t.RowGapMM, t.PaddingMM} {
+		if v < 0 || math.IsNaN(v) {
+			return page, nil, invalidf("margins, gaps and padding can't be negative")
+		}
+	}
+
+	w := (page.Wd - t.MarginLeftMM - t.MarginRightMM - float64(t.Columns-1)*t.ColumnGapMM) / float64(t.Columns)
+	h := (page.Ht - t.MarginTopMM - t.MarginBottomMM - float64(t.Rows-1)*t.RowGapMM) / float64(t.Rows)
+	if w-2*t.PaddingMM <= 0 || h-2*t.PaddingMM <= 0 {
+		return page, nil, invalidf("the labels don't fit on the page, reduce the margins, gaps or padding")
+	}
+
+	cells := make([]labelCell, 0, t.Rows*t.Columns)
+	for row := 0; row < t.Rows; row++ {
+		for col := 0; col < t.Columns; col++ {
+			cells = append(cells, labelCell{
+				x: t.MarginLeftMM + float64(col)*(w+t.ColumnGapMM) + t.PaddingMM,
+				y: t.MarginTopMM + float64(row)*(h+t.RowGapMM) + t.PaddingMM,
+				w: w - 2*t.PaddingMM,
+				h: h - 2*t.PaddingMM,
+			})
+		}
+	}
+	return page, cells, nil
+}
+
+// render stored codes onto label sheets, each code with its caption and frame is
+// scaled to fit its label and centered in it
+func (s *QRService) RenderSheet(req *models.SheetRequest) ([]byte, error) {
+	if len(req.IDs) == 0 {
+		return nil, invalidf("ids must list at least one QR code")
+	}
+	if len(req.IDs) > maxSheetCodes {
+		return nil, invalidf("a sheet can hold at most %d codes", maxSheetCodes)
+	}
+	page, cells, err := sheetLayout(req.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	// look every code up first so a bad id fails before anything is drawn
+	drawings := make([]*qrDrawing, len(req.IDs))
+	for i, id := range req.IDs {
+		qr, err := s.FindQRCode(id)
+		if err != nil {
+			if err.Error() == "QR code not found" {
+				return nil, invalidf("QR code %s not found", id)
+			}
+			return nil, err
+		}
+		opts, err := normalizeOptions(qr.Options)
+		if err != nil {
+			return nil, err
+		}
+		logo, err := s.findLogo(opts)
+		if err != nil {
+			return nil, err
+		}
+		if drawings[i], err = newDrawing(qr.ID, opts, logo); err != nil {
+			return nil, err
+		}
+	}
+
+	pdf := newPDF("mm", page)
+	for i, d := range drawings {
+		if i%len(cells) == 0 {
+			pdf.AddPage()
+		}
+		cell := cells[i%len(cells)]
+		canvas, _, _, err := d.canvas()
+		if err != nil {
+			return nil, err
+		}
+		scale := math.Min(cell.w/float64(canvas.X), cell.h/float64(canvas.Y))
+		x := cell.x + (cell.w-float64(canvas.X)*scale)/2
+		y := cell.y + (cell.h-float64(canvas.Y)*scale)/2
+		if err := drawPDF(pdf, d, x, y, scale); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
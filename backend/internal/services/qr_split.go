@@ -0,0 +1,107 @@
+package services
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	minVariants   = 2
+	maxVariants   = 10
+	maxWeight     = 1000
+	defaultWeight = 1
+)
+
+// variant names end up in cookies and analytics, so they are kept short and plain
+var variantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// check a split and fill in defaults. unnamed variants are called a, b, c and so
+// on, variants without a weight get an equal share
+func normalizeSplit(split models.Split) (models.Split, error) {
+	if len(split.Variants) == 0 {
+		return models.Split{}, nil
+	}
+	if len(split.Variants) < minVariants || len(split.Variants) > maxVariants {
+		return models.Split{}, invalidf("a split must have between %d and %d variants", minVariants, maxVariants)
+	}
+
+	seen := map[string]bool{}
+	variants := make([]models.Variant, 0, len(split.Variants))
+	for i, v := range split.Variants {
+		if v.Name == "" {
+			v.Name = string(rune('a' + i))
+		}
+		if !variantNamePattern.MatchString(v.Name) {
+			return models.Split{}, invalidf("variant name %q may only contain up to 32 letters, digits, dashes and underscores", v.Name)
+		}
+		if seen[v.Name] {
+			return models.Split{}, invalidf("variant name %q is used twice", v.Name)
+		}
+		seen[v.Name] = true
+
+		if v.Weight == 0 {
+			v.Weight = defaultWeight
+		}
+		if v.Weight < 0 || v.Weight > maxWeight {
+			return models.Split{}, invalidf("variant weight must be between 1 and %d", maxWeight)
+		}
+		variants = append(variants, v)
+	}
+	return models.Split{Variants: variants, Sticky: split.Sticky}, nil
+}
+
+// the variant a scan gets. a sticky split keeps the one remembered from an
+// earlier scan while it still exists
+func pickVariant(split models.Split, remembered string) (models.Variant, bool) {
+	if len(split.Variants) == 0 {
+		return models.Variant{}, false
+	}
+	if split.Sticky && remembered != "" {
+		for _, v := range split.Variants {
+			if v.Name == remembered {
+				return v, true
+			}
+		}
+	}
+
+	total := 0
+	for _, v := range split.Variants {
+		total += v.Weight
+	}
+	n := rand.Intn(total)
+	for _, v := range split.Variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+	return split.Variants[len(split.Variants)-1], true
+}
+
+// scans per variant of the current split, followed by variants that were
+// scanned before being removed from it
+func (s *QRService) VariantScanCounts(qr *models.QRCode) ([]models.VariantScanCount, error) {
+	counts, err := s.store.FindVariantScanCounts(qr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.VariantScanCount{}
+	for _, v := range qr.Split.Variants {
+		result = append(result, models.VariantScanCount{Name: v.Name, URL: v.URL, Weight: v.Weight, ScanCount: counts[v.Name]})
+		delete(counts, v.Name)
+	}
+	removed := make([]models.VariantScanCount, 0, len(counts))
+	for name, count := range counts {
+		removed = append(removed, models.VariantScanCount{Name: name, ScanCount: count})
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
+	return append(result, removed...), nil
+}
+
+func (s *QRService) IncrementVariantScanCount(id, variant string) error {
+	return s.store.IncrementVariantScanCount(id, variant)
+}
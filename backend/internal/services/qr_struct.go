@@ -3,16 +3,60 @@ package services
 import (
 	"database/sql"
 	"errors"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/phucnguyen/qrify/internal/models"
 )
 
+// postgres error code for a duplicate key
+const uniqueViolation = "23505"
+
+// columns read into a models.QRCode, in the order scanQRCode expects them
+const qrCodeColumns = `id, url, created_at, expires_at, scan_count, render_options, redirect_rules, schedule, split, tracking, password_hash, unlock_count, max_scans, status, deleted_at`
+
+// a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scan a row of qrCodeColumns, nil when there is no row
+func scanQRCode(row rowScanner) (*models.QRCode, error) {
+	var qr models.QRCode
+	if err := row.Scan(&qr.ID, &qr.URL, &qr.CreatedAt, &qr.ExpiresAt, &qr.ScanCount, &qr.Options, &qr.RedirectRules, &qr.Schedule, &qr.Split, &qr.Tracking, &qr.PasswordHash, &qr.UnlockCount, &qr.MaxScans, &qr.Status, &qr.DeletedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &qr, nil
+}
+
+// codes in the trash are left out of every lookup except FindTrashed
 type QRCodeStore interface {
 	Save(qr *models.QRCode) error
 	FindByID(id string) (*models.QRCode, error)
-	DeleteByID(id string) error
+	// move the code to the trash, it stays there until restored or purged
+	DeleteByID(id string, at time.Time) error
+	RestoreByID(id string) error
+	// trashed codes, most recently deleted first
+	FindTrashed() ([]*models.QRCode, error)
+	// delete codes trashed before the given time for good, with their history and scans
+	PurgeTrashed(before time.Time) (int64, error)
+	// archived codes are left out
 	FindByURL(url string) (*models.QRCode, error)
-	IncrementScanCount(id string) error
+	// update where a code points. a non nil change is recorded in its history
+	Update(qr *models.QRCode, change *models.DestinationChange) error
+	SetStatus(id, status string) error
+	FindDestinationHistory(id string) ([]models.DestinationChange, error)
+	// false without counting once the code has used up its max_scans
+	IncrementScanCount(id string) (bool, error)
+	IncrementVariantScanCount(id, variant string) error
+	IncrementUnlockCount(id string) error
+	// scans per variant name, variants without scans are left out
+	FindVariantScanCounts(id string) (map[string]int, error)
+	SaveLogo(logo *models.Logo) error
+	FindLogo(id string) (*models.Logo, error)
 }
 
 type PostgresQRCodeStore struct {
@@ -25,42 +69,204 @@ func NewPostgresQRCodeStore(db *sql.DB) *PostgresQRCodeStore {
 
 func (s *PostgresQRCodeStore) Save(qr *models.QRCode) error {
 	_, err := s.db.Exec(
-		`INSERT INTO qr_codes (id, url, created_at, expires_at, image_base64, scan_count) VALUES ($1, $2, $3, $4, $5, $6)`,
-		qr.ID, qr.URL, qr.CreatedAt, qr.ExpiresAt, qr.ImageBase64, qr.ScanCount,
+		`INSERT INTO qr_codes (id, url, created_at, expires_at, scan_count, render_options, redirect_rules, schedule, split, tracking, password_hash, max_scans, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		qr.ID, qr.URL, qr.CreatedAt, qr.ExpiresAt, qr.ScanCount, qr.Options, qr.RedirectRules, qr.Schedule, qr.Split, qr.Tracking, qr.PasswordHash, qr.MaxScans, qr.Status,
 	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrIDTaken
+	}
 	return err
 }
 
 func (s *PostgresQRCodeStore) FindByID(id string) (*models.QRCode, error) {
-	row := s.db.QueryRow(`SELECT id, url, created_at, expires_at, image_base64, scan_count FROM qr_codes WHERE id = $1`, id)
-	var qr models.QRCode
-	if err := row.Scan(&qr.ID, &qr.URL, &qr.CreatedAt, &qr.ExpiresAt, &qr.ImageBase64, &qr.ScanCount); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
+	return scanQRCode(s.db.QueryRow(`SELECT `+qrCodeColumns+` FROM qr_codes WHERE id = $1 AND deleted_at IS NULL`, id))
+}
+
+func (s *PostgresQRCodeStore) DeleteByID(id string, at time.Time) error {
+	_, err := s.db.Exec(`UPDATE qr_codes SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`, id, at)
+	return err
+}
+
+func (s *PostgresQRCodeStore) RestoreByID(id string) error {
+	res, err := s.db.Exec(`UPDATE qr_codes SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("QR code not found")
+	}
+	return nil
+}
+
+func (s *PostgresQRCodeStore) FindTrashed() ([]*models.QRCode, error) {
+	rows, err := s.db.Query(`SELECT ` + qrCodeColumns + ` FROM qr_codes WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
 		return nil, err
 	}
-	return &qr, nil
+	defer rows.Close()
+
+	trashed := []*models.QRCode{}
+	for rows.Next() {
+		qr, err := scanQRCode(rows)
+		if err != nil {
+			return nil, err
+		}
+		trashed = append(trashed, qr)
+	}
+	return trashed, rows.Err()
 }
 
-func (s *PostgresQRCodeStore) DeleteByID(id string) error {
-	_, err := s.db.Exec(`DELETE FROM qr_codes WHERE id = $1`, id)
-	return err
+// the history and variant scans go with the code through ON DELETE CASCADE
+func (s *PostgresQRCodeStore) PurgeTrashed(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM qr_codes WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
 func (s *PostgresQRCodeStore) FindByURL(url string) (*models.QRCode, error) {
-	row := s.db.QueryRow(`SELECT id, url, created_at, expires_at, image_base64, scan_count FROM qr_codes WHERE url = $1`, url)
-	var qr models.QRCode
-	if err := row.Scan(&qr.ID, &qr.URL, &qr.CreatedAt, &qr.ExpiresAt, &qr.ImageBase64, &qr.ScanCount); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+	return scanQRCode(s.db.QueryRow(`SELECT `+qrCodeColumns+` FROM qr_codes WHERE url = $1 AND status <> 'archived' AND deleted_at IS NULL`, url))
+}
+
+func (s *PostgresQRCodeStore) SetStatus(id, status string) error {
+	res, err := s.db.Exec(`UPDATE qr_codes SET status = $2 WHERE id = $1 AND deleted_at IS NULL`, id, status)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("QR code not found")
+	}
+	return nil
+}
+
+func (s *PostgresQRCodeStore) Update(qr *models.QRCode, change *models.DestinationChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE qr_codes SET url = $2, expires_at = $3, redirect_rules = $4, schedule = $5, split = $6, tracking = $7, password_hash = $8, max_scans = $9 WHERE id = $1 AND deleted_at IS NULL`,
+		qr.ID, qr.URL, qr.ExpiresAt, qr.RedirectRules, qr.Schedule, qr.Split, qr.Tracking, qr.PasswordHash, qr.MaxScans,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("QR code not found")
+	}
+
+	if change == nil {
+		return tx.Commit()
+	}
+	err = tx.QueryRow(
+		`INSERT INTO qr_destination_history (qr_code_id, old_url, new_url, old_expires_at, new_expires_at, changed_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		change.QRCodeID, change.OldURL, change.NewURL, change.OldExpiresAt, change.NewExpiresAt, change.ChangedAt,
+	).Scan(&change.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// changes of a code, oldest first
+func (s *PostgresQRCodeStore) FindDestinationHistory(id string) ([]models.DestinationChange, error) {
+	rows, err := s.db.Query(
+		`SELECT id, qr_code_id, old_url, new_url, old_expires_at, new_expires_at, changed_at FROM qr_destination_history WHERE qr_code_id = $1 ORDER BY changed_at, id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.DestinationChange{}
+	for rows.Next() {
+		var change models.DestinationChange
+		if err := rows.Scan(&change.ID, &change.QRCodeID, &change.OldURL, &change.NewURL, &change.OldExpiresAt, &change.NewExpiresAt, &change.ChangedAt); err != nil {
+			return nil, err
 		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// the limit is checked in the same statement, concurrent scans wait on the row
+// lock and see each other's increments so they can't go past max_scans
+func (s *PostgresQRCodeStore) IncrementScanCount(id string) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE qr_codes SET scan_count = scan_count + 1 WHERE id = $1 AND (max_scans = 0 OR scan_count < max_scans)`,
+		id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *PostgresQRCodeStore) IncrementUnlockCount(id string) error {
+	_, err := s.db.Exec(`UPDATE qr_codes SET unlock_count = unlock_count + 1 WHERE id = $1`, id)
+	return err
+}
+
+func (s *PostgresQRCodeStore) IncrementVariantScanCount(id, variant string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO qr_variant_scans (qr_code_id, variant, scan_count) VALUES ($1, $2, 1)
+		ON CONFLICT (qr_code_id, variant) DO UPDATE SET scan_count = qr_variant_scans.scan_count + 1`,
+		id, variant,
+	)
+	return err
+}
+
+func (s *PostgresQRCodeStore) FindVariantScanCounts(id string) (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT variant, scan_count FROM qr_variant_scans WHERE qr_code_id = $1`, id)
+	if err != nil {
 		return nil, err
 	}
-	return &qr, nil
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var variant string
+		var count int
+		if err := rows.Scan(&variant, &count); err != nil {
+			return nil, err
+		}
+		counts[variant] = count
+	}
+	return counts, rows.Err()
 }
 
-func (s *PostgresQRCodeStore) IncrementScanCount(id string) error {
-	_, err := s.db.Exec(`UPDATE qr_codes SET scan_count = scan_count + 1 WHERE id = $1`, id)
+// logos are content addressed, saving the same image twice keeps the first row
+func (s *PostgresQRCodeStore) SaveLogo(logo *models.Logo) error {
+	_, err := s.db.Exec(
+		`INSERT INTO logos (id, content_type, width, height, created_at, data) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (id) DO NOTHING`,
+		logo.ID, logo.ContentType, logo.Width, logo.Height, logo.CreatedAt, logo.Data,
+	)
 	return err
 }
+
+func (s *PostgresQRCodeStore) FindLogo(id string) (*models.Logo, error) {
+	row := s.db.QueryRow(`SELECT id, content_type, width, height, created_at, data FROM logos WHERE id = $1`, id)
+	var logo models.Logo
+	if err := row.Scan(&logo.ID, &logo.ContentType, &logo.Width, &logo.Height, &logo.CreatedAt, &logo.Data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &logo, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	styleSquare  = "square"
+	styleRounded = "rounded"
+	styleDots    = "dots"
+
+	finderModules = 7
+	// share of a module a dot covers, small enough to keep the gaps visible
+	dotRadius = 0.45
+)
+
+var styles = []string{styleSquare, styleRounded, styleDots}
+
+// corner radii of the finder pattern's outer square, the hole inside it and the
+// eye in the middle, in modules. radii past half the side make circles
+var finderRadii = map[string][3]float32{
+	styleSquare:  {0, 0, 0},
+	styleRounded: {2, 1, 1},
+	styleDots:    {3.5, 2.5, 1.5},
+}
+
+func normalizeStyle(style, field string) (string, error) {
+	if style == "" {
+		return styleSquare, nil
+	}
+	style = strings.ToLower(style)
+	for _, s := range styles {
+		if s == style {
+			return style, nil
+		}
+	}
+	return "", invalidf("%s must be one of %s", field, strings.Join(styles, ", "))
+}
+
+func normalizeStyles(opts *models.RenderOptions) error {
+	var err error
+	if opts.ModuleStyle, err = normalizeStyle(opts.ModuleStyle, "module_style"); err != nil {
+		return err
+	}
+	if opts.FinderStyle, err = normalizeStyle(opts.FinderStyle, "finder_style"); err != nil {
+		return err
+	}
+	if opts.FinderColor, err = normalizeColor(opts.FinderColor, opts.ForegroundColor); err != nil {
+		return err
+	}
+	return nil
+}
+
+// top left module of each of the three finder patterns
+func finderOrigins(modules int) []image.Point {
+	n := modules - finderModules
+	return []image.Point{{0, 0}, {n, 0}, {0, n}}
+}
+
+func inFinder(x, y, modules int) bool {
+	for _, o := range finderOrigins(modules) {
+		if x >= o.X && x < o.X+finderModules && y >= o.Y && y < o.Y+finderModules {
+			return true
+		}
+	}
+	return false
+}
+
+// finder patterns are drawn on their own unless the code is plain squares in one color
+func (d *qrDrawing) separateFinders() bool {
+	return d.moduleStyle != styleSquare || d.finderStyle != styleSquare || d.finderColor != d.fg
+}
+
+// first pixel of module m, see modulePixel
+func (d *qrDrawing) px(m int) float32 {
+	return float32(modulePixel(m, len(d.bitmap), d.size))
+}
+
+// whether module x, y is drawn as a data module
+func (d *qrDrawing) dark(x, y int) bool {
+	modules := len(d.bitmap)
+	if x < 0 || y < 0 || x >= modules || y >= modules || !d.bitmap[y][x] {
+		return false
+	}
+	if image.Pt(x, y).In(d.logoBox) {
+		return false
+	}
+	return !d.separateFinders() || !inFinder(x, y, modules)
+}
+
+// the data modules in the module style, in pixels. square modules land on whole
+// pixels so they come out exactly like the plain bitmap
+func (d *qrDrawing) modulesPath() *Path {
+	p := &Path{}
+	modules := len(d.bitmap)
+	unit := float32(d.size) / float32(modules)
+	for y := 0; y < modules; y++ {
+		for x := 0; x < modules; x++ {
+			if !d.dark(x, y) {
+				continue
+			}
+			x0, y0 := d.px(x), d.px(y)
+			w, h := d.px(x+1)-x0, d.px(y+1)-y0
+			switch d.moduleStyle {
+			case styleDots:
+				p.Circle(x0+w/2, y0+h/2, unit*dotRadius)
+			case styleRounded:
+				// only corners without a neighbour on either side are rounded, so
+				// neighbouring modules join into smooth blobs
+				up, down, left, right := d.dark(x, y-1), d.dark(x, y+1), d.dark(x-1, y), d.dark(x+1, y)
+				roundedCell(p, x0, y0, w, h, unit/2, [4]bool{
+					!up && !left, !up && !right, !down && !right, !down && !left,
+				})
+			default:
+				p.Rect(x0, y0, w, h)
+			}
+		}
+	}
+	return p
+}
+
+// the three finder patterns in the finder style, nil when they are drawn as part
+// of the modules
+func (d *qrDrawing) finderPath() *Path {
+	if !d.separateFinders() {
+		return nil
+	}
+	p := &Path{}
+	unit := float32(d.size) / float32(len(d.bitmap))
+	radii := finderRadii[d.finderStyle]
+	for _, o := range finderOrigins(len(d.bitmap)) {
+		box := func(from, to int) (float32, float32, float32, float32) {
+			x, y := d.px(o.X+from), d.px(o.Y+from)
+			return x, y, d.px(o.X+to) - x, d.px(o.Y+to) - y
+		}
+		x, y, w, h := box(0, 7)
+		p.RoundedRect(x, y, w, h, radii[0]*unit, true)
+		x, y, w, h = box(1, 6)
+		p.RoundedRect(x, y, w, h, radii[1]*unit, false)
+		x, y, w, h = box(2, 5)
+		p.RoundedRect(x, y, w, h, radii[2]*unit, true)
+	}
+	return p
+}
+
+// draw the modules of the code on its background at d.size
+func drawModules(d *qrDrawing) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, d.size, d.size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(d.bg), image.Point{}, draw.Src)
+	d.modulesPath().fill(img, d.fg)
+	if finder := d.finderPath(); finder != nil {
+		finder.fill(img, d.finderColor)
+	}
+	return img
+}
+
+// a module cell with some of its corners rounded, clockwise from the top left
+func roundedCell(p *Path, x, y, w, h, r float32, round [4]bool) {
+	if r > w/2 {
+		r = w / 2
+	}
+	if r > h/2 {
+		r = h / 2
+	}
+	var radii [4]float32
+	for i, ok := range round {
+		if ok {
+			radii[i] = r
+		}
+	}
+	tl, tr, br, bl := radii[0], radii[1], radii[2], radii[3]
+	const k = 1 - bezierCircle
+	x1, y1 := x+w, y+h
+	p.MoveTo(x+tl, y)
+	p.LineTo(x1-tr, y)
+	if tr > 0 {
+		p.CubeTo(x1-tr*k, y, x1, y+tr*k, x1, y+tr)
+	}
+	p.LineTo(x1, y1-br)
+	if br > 0 {
+		p.CubeTo(x1, y1-br*k, x1-br*k, y1, x1-br, y1)
+	}
+	p.LineTo(x+bl, y1)
+	if bl > 0 {
+		p.CubeTo(x+bl*k, y1, x, y1-bl*k, x, y1-bl)
+	}
+	p.LineTo(x, y+tl)
+	if tl > 0 {
+		p.CubeTo(x, y+tl*k, x+tl*k, y, x+tl, y)
+	}
+	p.Close()
+}
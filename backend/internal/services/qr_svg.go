@@ -0,0 +1,119 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+)
+
+// draw the module matrix, caption and frame as svg paths. the geometry matches
+// the png output so both formats decode to the same grid at any scale
+func renderSVG(d *qrDrawing) ([]byte, error) {
+	size, caption, fg, bg := d.size, d.caption, d.fg, d.bg
+	modules := len(d.bitmap)
+	canvas, offset, shapes, err := d.canvas()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	// with a dpi the svg gets its printed size, the view box stays in pixels
+	width, height := fmt.Sprint(canvas.X), fmt.Sprint(canvas.Y)
+	if d.dpi != 0 {
+		width, height = pixelsToMM(canvas.X, d.dpi), pixelsToMM(canvas.Y, d.dpi)
+	}
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %d %d">`, width, height, canvas.X, canvas.Y)
+	if bg.A != 0 {
+		fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, canvas.X, canvas.Y, hexColor(bg))
+	}
+	for _, shape := range shapes {
+		fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(shape.Color))
+		shape.Path.writeSVG(&buf)
+		buf.WriteString(`"/>`)
+	}
+	if offset != (image.Point{}) {
+		fmt.Fprintf(&buf, `<g transform="translate(%d %d)">`, offset.X, offset.Y)
+	}
+
+	if d.quiet > 0 {
+		fmt.Fprintf(&buf, `<g transform="translate(%d %d)">`, d.quiet, d.quiet)
+	}
+	if d.moduleStyle == styleSquare {
+		// square modules are drawn in module units and scaled up to the image size
+		fmt.Fprintf(&buf, `<path transform="scale(%g)" fill="%s" shape-rendering="crispEdges" d="`, float64(size)/float64(modules), hexColor(fg))
+		row := make([]bool, modules)
+		for y := range d.bitmap {
+			// svg can't erase, so modules under the logo are left out instead
+			for x := range row {
+				row[x] = d.dark(x, y)
+			}
+			writeRuns(&buf, row, 0, y)
+		}
+	} else {
+		fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(fg))
+		d.modulesPath().writeSVG(&buf)
+	}
+	buf.WriteString(`"/>`)
+	if finder := d.finderPath(); finder != nil {
+		fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(d.finderColor))
+		finder.writeSVG(&buf)
+		buf.WriteString(`"/>`)
+	}
+
+	if d.logo != nil {
+		r := logoRect(d)
+		fmt.Fprintf(&buf, `<image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="xMidYMid meet" href="data:%s;base64,%s"/>`,
+			r.Min.X, r.Min.Y, r.Dx(), r.Dy(), d.logo.ContentType, base64.StdEncoding.EncodeToString(d.logo.Data))
+	}
+	if d.quiet > 0 {
+		buf.WriteString(`</g>`)
+	}
+
+	if caption != nil {
+		fmt.Fprintf(&buf, `<path transform="translate(0 %d)" fill="%s" d="`, d.blockSize()+captionGap, hexColor(fg))
+		if err := caption.writePath(&buf, d.blockSize()); err != nil {
+			return nil, err
+		}
+		buf.WriteString(`"/>`)
+	}
+
+	if offset != (image.Point{}) {
+		buf.WriteString(`</g>`)
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+// call fn with the bounds of every horizontal run of set cells
+func eachRun(row []bool, fn func(start, end int)) {
+	for x := 0; x < len(row); {
+		if !row[x] {
+			x++
+			continue
+		}
+		start := x
+		for x < len(row) && row[x] {
+			x++
+		}
+		fn(start, x)
+	}
+}
+
+// write one subpath per horizontal run of set cells
+func writeRuns(buf *bytes.Buffer, row []bool, x0, y int) {
+	eachRun(row, func(start, end int) {
+		fmt.Fprintf(buf, "M%d %dh%dv1h-%dz", x0+start, y, end-start, end-start)
+	})
+}
+
+func writeMaskRuns(buf *bytes.Buffer, mask *image.Alpha) {
+	b := mask.Bounds()
+	row := make([]bool, b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			row[x-b.Min.X] = mask.AlphaAt(x, y).A >= 0x80
+		}
+		writeRuns(buf, row, b.Min.X, y-b.Min.Y)
+	}
+}
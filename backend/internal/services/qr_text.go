@@ -0,0 +1,68 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// quiet zone around text codes in modules, terminals have no margin of their own
+const textQuietZone = 4
+
+// draw the code as text for terminals. the utf-8 version packs two module rows
+// into one line with half blocks and draws the light modules, like qrencode, so
+// it scans on the usual dark terminal. the ascii version draws the dark modules
+// two characters wide for light backgrounds and plain text files. styles, colors
+// and the logo don't apply, the caption follows as plain text
+func renderText(d *qrDrawing, ascii bool) []byte {
+	modules := len(d.bitmap)
+	dark := func(x, y int) bool {
+		x, y = x-textQuietZone, y-textQuietZone
+		return x >= 0 && y >= 0 && x < modules && y < modules && d.bitmap[y][x]
+	}
+	n := modules + 2*textQuietZone
+
+	var buf bytes.Buffer
+	width := n
+	if ascii {
+		width = 2 * n
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				if dark(x, y) {
+					buf.WriteString("##")
+				} else {
+					buf.WriteString("  ")
+				}
+			}
+			buf.WriteByte('\n')
+		}
+	} else {
+		for y := 0; y < n; y += 2 {
+			for x := 0; x < n; x++ {
+				top, bottom := !dark(x, y), y+1 < n && !dark(x, y+1)
+				switch {
+				case top && bottom:
+					buf.WriteString("█")
+				case top:
+					buf.WriteString("▀")
+				case bottom:
+					buf.WriteString("▄")
+				default:
+					buf.WriteByte(' ')
+				}
+			}
+			buf.WriteByte('\n')
+		}
+	}
+
+	if d.caption != nil {
+		for _, line := range d.caption.lines {
+			if pad := (width - utf8.RuneCountInString(line.text)) / 2; pad > 0 {
+				buf.WriteString(strings.Repeat(" ", pad))
+			}
+			buf.WriteString(line.text)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
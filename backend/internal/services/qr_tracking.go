@@ -0,0 +1,99 @@
+package services
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	maxTrackingParams     = 20
+	maxTrackingParamBytes = 256
+)
+
+func normalizeTracking(tracking models.Tracking) (models.Tracking, error) {
+	if len(tracking.UTM) > maxTrackingParams {
+		return models.Tracking{}, invalidf("utm can have at most %d parameters", maxTrackingParams)
+	}
+	utm := map[string]string{}
+	for key, value := range tracking.UTM {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return models.Tracking{}, invalidf("utm parameter names can't be empty")
+		}
+		if len(key) > maxTrackingParamBytes || len(value) > maxTrackingParamBytes {
+			return models.Tracking{}, invalidf("utm parameter %q is longer than %d bytes", key, maxTrackingParamBytes)
+		}
+		utm[key] = value
+	}
+	if len(utm) == 0 {
+		utm = nil
+	}
+	return models.Tracking{UTM: utm, ForwardQuery: tracking.ForwardQuery}, nil
+}
+
+// parameters every code gets unless it sets them itself, from QR_DEFAULT_UTM
+// written as a query string like utm_source=qr&utm_medium=print
+func defaultUTM() url.Values {
+	raw := os.Getenv("QR_DEFAULT_UTM")
+	if raw == "" {
+		return nil
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid QR_DEFAULT_UTM: %v", err)
+		return nil
+	}
+	return values
+}
+
+// add query parameters to the destination without replacing any it has. the
+// query of the scan comes first when forwarded, then the code's utm parameters,
+// then the defaults
+func withTracking(destination string, qr *models.QRCode, v Visitor, variant string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	existing := u.Query()
+	added := url.Values{}
+	add := func(key string, values []string) {
+		if _, ok := existing[key]; ok {
+			return
+		}
+		if _, ok := added[key]; ok {
+			return
+		}
+		added[key] = values
+	}
+
+	if qr.Tracking.ForwardQuery {
+		for key, values := range v.Query {
+			add(key, values)
+		}
+	}
+	placeholders := strings.NewReplacer("{id}", qr.ID, "{variant}", variant)
+	for key, value := range qr.Tracking.UTM {
+		add(key, []string{placeholders.Replace(value)})
+	}
+	for key, values := range defaultUTM() {
+		for i := range values {
+			values[i] = placeholders.Replace(values[i])
+		}
+		add(key, values)
+	}
+
+	if len(added) == 0 {
+		return destination
+	}
+	// appended so the destination's own query keeps its order
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += added.Encode()
+	return u.String()
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/phucnguyen/qrify/internal/models"
+)
+
+const (
+	defaultTrashRetentionDays = 30
+	// how often the background purge looks for codes past the retention
+	trashPurgeInterval = time.Hour
+)
+
+// how long deleted codes stay restorable, QR_TRASH_RETENTION_DAYS
+func trashRetention() time.Duration {
+	days := envInt("QR_TRASH_RETENTION_DAYS", defaultTrashRetentionDays)
+	if days < 0 {
+		days = defaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// move the code to the trash, scans of it are treated as not found until it is restored
+func (s *QRService) DeleteQRCode(id string) error {
+	return s.store.DeleteByID(id, time.Now().UTC())
+}
+
+// take the code back out of the trash as it was before
+func (s *QRService) RestoreQRCode(id string) (*models.QRCodeResponse, error) {
+	if err := s.store.RestoreByID(id); err != nil {
+		return nil, err
+	}
+	return s.GetQRCode(id)
+}
+
+// the codes in the trash and when each one is purged
+func (s *QRService) ListTrash() ([]models.TrashedQRCode, error) {
+	trashed, err := s.store.FindTrashed()
+	if err != nil {
+		return nil, err
+	}
+	retention := trashRetention()
+	list := make([]models.TrashedQRCode, 0, len(trashed))
+	for _, qr := range trashed {
+		list = append(list, models.TrashedQRCode{
+			ID:        qr.ID,
+			URL:       qr.URL,
+			CreatedAt: qr.CreatedAt,
+			ScanCount: qr.ScanCount,
+			Status:    statusOf(qr),
+			DeletedAt: *qr.DeletedAt,
+			PurgeAt:   qr.DeletedAt.Add(retention),
+		})
+	}
+	return list, nil
+}
+
+// delete codes that have been in the trash longer than the retention for good
+func (s *QRService) PurgeTrash() (int64, error) {
+	return s.store.PurgeTrashed(time.Now().UTC().Add(-trashRetention()))
+}
+
+// purge the trash now and then every trashPurgeInterval until the process exits
+func (s *QRService) StartTrashPurge() {
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			n, err := s.PurgeTrash()
+			if err != nil {
+				log.Printf("Failed to purge trashed QR codes: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d trashed QR codes", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// kappa for approximating a quarter circle with a cubic bezier
+const bezierCircle = 0.5522847
+
+type pathOp int
+
+const (
+	opMoveTo pathOp = iota
+	opLineTo
+	opQuadTo
+	opCubeTo
+	opClose
+)
+
+type pathCmd struct {
+	op   pathOp
+	args [6]float32
+}
+
+// Path is a vector outline in image pixels. The same path is rasterized for png
+// and jpeg output and written as path data for svg, so both match. Filling uses
+// the nonzero rule, holes are drawn in the opposite direction
+type Path struct {
+	cmds []pathCmd
+}
+
+func (p *Path) MoveTo(x, y float32) {
+	p.cmds = append(p.cmds, pathCmd{op: opMoveTo, args: [6]float32{x, y}})
+}
+
+func (p *Path) LineTo(x, y float32) {
+	p.cmds = append(p.cmds, pathCmd{op: opLineTo, args: [6]float32{x, y}})
+}
+
+func (p *Path) QuadTo(x1, y1, x, y float32) {
+	p.cmds = append(p.cmds, pathCmd{op: opQuadTo, args: [6]float32{x1, y1, x, y}})
+}
+
+func (p *Path) CubeTo(x1, y1, x2, y2, x, y float32) {
+	p.cmds = append(p.cmds, pathCmd{op: opCubeTo, args: [6]float32{x1, y1, x2, y2, x, y}})
+}
+
+func (p *Path) Close() {
+	p.cmds = append(p.cmds, pathCmd{op: opClose})
+}
+
+// Rect adds a closed clockwise rectangle
+func (p *Path) Rect(x, y, w, h float32) {
+	p.MoveTo(x, y)
+	p.LineTo(x+w, y)
+	p.LineTo(x+w, y+h)
+	p.LineTo(x, y+h)
+	p.Close()
+}
+
+// RoundedRect adds a closed rectangle with corners of radius r. Clockwise rects
+// fill, counter clockwise ones cut a hole into a clockwise rect around them
+func (p *Path) RoundedRect(x, y, w, h, r float32, clockwise bool) {
+	if r > w/2 {
+		r = w / 2
+	}
+	if r > h/2 {
+		r = h / 2
+	}
+	k := r * (1 - bezierCircle)
+	x1, y1 := x+w, y+h
+	if clockwise {
+		p.MoveTo(x+r, y)
+		p.LineTo(x1-r, y)
+		p.CubeTo(x1-k, y, x1, y+k, x1, y+r)
+		p.LineTo(x1, y1-r)
+		p.CubeTo(x1, y1-k, x1-k, y1, x1-r, y1)
+		p.LineTo(x+r, y1)
+		p.CubeTo(x+k, y1, x, y1-k, x, y1-r)
+		p.LineTo(x, y+r)
+		p.CubeTo(x, y+k, x+k, y, x+r, y)
+	} else {
+		p.MoveTo(x+r, y)
+		p.CubeTo(x+k, y, x, y+k, x, y+r)
+		p.LineTo(x, y1-r)
+		p.CubeTo(x, y1-k, x+k, y1, x+r, y1)
+		p.LineTo(x1-r, y1)
+		p.CubeTo(x1-k, y1, x1, y1-k, x1, y1-r)
+		p.LineTo(x1, y+r)
+		p.CubeTo(x1, y+k, x1-k, y, x1-r, y)
+	}
+	p.Close()
+}
+
+// Circle adds a closed clockwise circle
+func (p *Path) Circle(cx, cy, r float32) {
+	p.RoundedRect(cx-r, cy-r, 2*r, 2*r, r, true)
+}
+
+// Ring adds the outline of a rounded rect of the given stroke width, drawn inside the rect
+func (p *Path) Ring(x, y, w, h, r, stroke float32) {
+	p.RoundedRect(x, y, w, h, r, true)
+	inner := r - stroke
+	if inner < 0 {
+		inner = 0
+	}
+	p.RoundedRect(x+stroke, y+stroke, w-2*stroke, h-2*stroke, inner, false)
+}
+
+func (p *Path) writeSVG(buf *bytes.Buffer) {
+	for _, cmd := range p.cmds {
+		a := cmd.args
+		switch cmd.op {
+		case opMoveTo:
+			fmt.Fprintf(buf, "M%g %g", a[0], a[1])
+		case opLineTo:
+			fmt.Fprintf(buf, "L%g %g", a[0], a[1])
+		case opQuadTo:
+			fmt.Fprintf(buf, "Q%g %g %g %g", a[0], a[1], a[2], a[3])
+		case opCubeTo:
+			fmt.Fprintf(buf, "C%g %g %g %g %g %g", a[0], a[1], a[2], a[3], a[4], a[5])
+		case opClose:
+			buf.WriteString("Z")
+		}
+	}
+}
+
+// fill the path in color c over dst
+func (p *Path) fill(dst *image.NRGBA, c color.Color) {
+	b := dst.Bounds()
+	z := vector.NewRasterizer(b.Max.X, b.Max.Y)
+	for _, cmd := range p.cmds {
+		a := cmd.args
+		switch cmd.op {
+		case opMoveTo:
+			z.MoveTo(a[0], a[1])
+		case opLineTo:
+			z.LineTo(a[0], a[1])
+		case opQuadTo:
+			z.QuadTo(a[0], a[1], a[2], a[3])
+		case opCubeTo:
+			z.CubeTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		case opClose:
+			z.ClosePath()
+		}
+	}
+	mask := image.NewAlpha(z.Bounds())
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	draw.DrawMask(dst, b, image.NewUniform(c), image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// Shape is a filled path, frames are drawn as a list of shapes
+type Shape struct {
+	Path  *Path
+	Color color.NRGBA
+}
+
+// add the glyph outlines of text to the path, starting the baseline at dot
+func appendTextPath(p *Path, f *sfnt.Font, ppem fixed.Int26_6, text string, dot fixed.Point26_6) error {
+	var b sfnt.Buffer
+	var prev sfnt.GlyphIndex
+	for i, r := range []rune(text) {
+		idx, err := f.GlyphIndex(&b, r)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if kern, err := f.Kern(&b, prev, idx, ppem, font.HintingNone); err == nil {
+				dot.X += kern
+			}
+		}
+
+		segments, err := f.LoadGlyph(&b, idx, ppem, nil)
+		if err != nil {
+			return err
+		}
+		pt := func(q fixed.Point26_6) (float32, float32) {
+			return float32(q.X+dot.X) / 64, float32(q.Y+dot.Y) / 64
+		}
+		for j, seg := range segments {
+			switch seg.Op {
+			case sfnt.SegmentOpMoveTo:
+				if j > 0 {
+					p.Close()
+				}
+				p.MoveTo(pt(seg.Args[0]))
+			case sfnt.SegmentOpLineTo:
+				p.LineTo(pt(seg.Args[0]))
+			case sfnt.SegmentOpQuadTo:
+				x1, y1 := pt(seg.Args[0])
+				x, y := pt(seg.Args[1])
+				p.QuadTo(x1, y1, x, y)
+			case sfnt.SegmentOpCubeTo:
+				x1, y1 := pt(seg.Args[0])
+				x2, y2 := pt(seg.Args[1])
+				x, y := pt(seg.Args[2])
+				p.CubeTo(x1, y1, x2, y2, x, y)
+			}
+		}
+		if len(segments) > 0 {
+			p.Close()
+		}
+
+		advance, err := f.GlyphAdvance(&b, idx, ppem, font.HintingNone)
+		if err != nil {
+			return err
+		}
+		dot.X += advance
+		prev = idx
+	}
+	return nil
+}
+
+// TextPath lays out a single line of text centered on cx with its baseline at y.
+// The size shrinks until the text fits in maxWidth
+func TextPath(f *sfnt.Font, text string, size, cx, y, maxWidth float32) (*Path, error) {
+	var b sfnt.Buffer
+	ppem := fixed.Int26_6(size * 64)
+	width, err := measureText(f, &b, text, ppem)
+	if err != nil {
+		return nil, err
+	}
+	if width > maxWidth && width > 0 {
+		ppem = fixed.Int26_6(float32(ppem) * maxWidth / width)
+		width = maxWidth
+	}
+
+	p := &Path{}
+	dot := fixed.Point26_6{X: fixed.Int26_6((cx - width/2) * 64), Y: fixed.Int26_6(y * 64)}
+	if err := appendTextPath(p, f, ppem, text, dot); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func measureText(f *sfnt.Font, b *sfnt.Buffer, text string, ppem fixed.Int26_6) (float32, error) {
+	var width fixed.Int26_6
+	var prev sfnt.GlyphIndex
+	for i, r := range []rune(text) {
+		idx, err := f.GlyphIndex(b, r)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 {
+			if kern, err := f.Kern(b, prev, idx, ppem, font.HintingNone); err == nil {
+				width += kern
+			}
+		}
+		advance, err := f.GlyphAdvance(b, idx, ppem, font.HintingNone)
+		if err != nil {
+			return 0, err
+		}
+		width += advance
+		prev = idx
+	}
+	return float32(width) / 64, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/phucnguyen/qrify/internal/models"
+	xdraw "golang.org/x/image/draw"
+)
+
+// values of QR_VERIFY. codes that don't decode are rejected by default, warn
+// only logs them and off skips decoding altogether
+const (
+	verifyReject = "reject"
+	verifyWarn   = "warn"
+	verifyOff    = "off"
+)
+
+func verifyMode() string {
+	switch mode := os.Getenv("QR_VERIFY"); mode {
+	case verifyWarn, verifyOff:
+		return mode
+	default:
+		return verifyReject
+	}
+}
+
+// put the image on white with a quiet zone of width/div around it, the way it ends
+// up printed. our images have no border of their own
+func withQuietZone(img image.Image, div int) *image.NRGBA {
+	b := img.Bounds()
+	quiet := b.Dx() / div
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx()+2*quiet, b.Dy()+2*quiet))
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(out, b.Sub(b.Min).Add(image.Pt(quiet, quiet)), img, b.Min, draw.Over)
+	return out
+}
+
+// the detector misjudges the module size of a few codes at some pixel sizes and
+// quiet zones, and the data of a few others throws off its search for the finder
+// patterns of an upright code. a scanner sees a code at many distances and angles,
+// so one that doesn't decode is tried again turned a quarter and scaled by these
+// factors with these quiet zones
+var (
+	decodeRetryScales = []float64{1, 0.75, 1.5, 2, 0.5}
+	decodeQuietZones  = []int{8, 6, 4}
+)
+
+// decode the qr code in img
+func decodeQRCode(img image.Image) (string, error) {
+	var err error
+	b := img.Bounds()
+	for _, scale := range decodeRetryScales {
+		scaled := img
+		if scale != 1 {
+			dst := image.NewNRGBA(image.Rect(0, 0, int(float64(b.Dx())*scale), int(float64(b.Dy())*scale)))
+			xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+			scaled = dst
+		}
+		for _, div := range decodeQuietZones {
+			framed := withQuietZone(scaled, div)
+			for _, turned := range []image.Image{framed, rotate90(framed)} {
+				var text string
+				if text, err = decodeQRCodeOnce(turned); err == nil {
+					return text, nil
+				}
+			}
+		}
+	}
+	return "", err
+}
+
+// img turned a quarter clockwise
+func rotate90(img *image.NRGBA) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			out.SetNRGBA(b.Dy()-1-y, x, img.NRGBAAt(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
+
+func decodeQRCodeOnce(img image.Image) (string, error) {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.GetText(), nil
+}
+
+// whether a rendered image decodes to the redirect url of id. svg and pdf aren't
+// rasterized here, the png drawn from the same options is checked instead since
+// all formats share their geometry
+func verifyImage(id string, opts models.RenderOptions, logo *models.Logo, data []byte) (bool, error) {
+	if opts.Format != FormatPNG && opts.Format != FormatJPEG {
+		opts.Format = FormatPNG
+		var err error
+		if data, err = renderQRCode(id, opts, logo); err != nil {
+			return false, err
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	text, err := decodeQRCode(img)
+	if err != nil {
+		return false, nil
+	}
+	return text == redirectURL(id), nil
+}
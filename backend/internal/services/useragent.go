@@ -0,0 +1,58 @@
+package services
+
+import "strings"
+
+const (
+	osIOS      = "ios"
+	osAndroid  = "android"
+	osWindows  = "windows"
+	osMacOS    = "macos"
+	osLinux    = "linux"
+	osChromeOS = "chromeos"
+
+	deviceMobile  = "mobile"
+	deviceTablet  = "tablet"
+	deviceDesktop = "desktop"
+)
+
+var (
+	operatingSystems = []string{osIOS, osAndroid, osWindows, osMacOS, osLinux, osChromeOS}
+	devices          = []string{deviceMobile, deviceTablet, deviceDesktop}
+)
+
+// the operating system and kind of device a browser runs on
+type userAgent struct {
+	os     string
+	device string
+}
+
+// read the os and device from a User-Agent header. only what redirect rules need
+// is recognized, anything else leaves the fields empty. the order matters, many
+// agents name other platforms for compatibility
+func parseUserAgent(header string) userAgent {
+	ua := strings.ToLower(header)
+	switch {
+	case strings.Contains(ua, "windows phone"):
+		return userAgent{osWindows, deviceMobile}
+	case strings.Contains(ua, "ipad"):
+		return userAgent{osIOS, deviceTablet}
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		return userAgent{osIOS, deviceMobile}
+	case strings.Contains(ua, "android"):
+		// android tablets leave "mobile" out of the agent
+		if strings.Contains(ua, "mobile") {
+			return userAgent{osAndroid, deviceMobile}
+		}
+		return userAgent{osAndroid, deviceTablet}
+	// the platform token as in "X11; CrOS x86_64", a bare "cros" is also in "microsoft"
+	case strings.Contains(ua, "cros "):
+		return userAgent{osChromeOS, deviceDesktop}
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return userAgent{osMacOS, deviceDesktop}
+	case strings.Contains(ua, "windows"):
+		return userAgent{osWindows, deviceDesktop}
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return userAgent{osLinux, deviceDesktop}
+	}
+	return userAgent{}
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func createAndDecode(t *testing.T, router *gin.Engine, req *models.QRCodeRequest) (models.QRCodeResponse, []byte) {
+	w := postQRCode(router, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	img, err := base64.StdEncoding.DecodeString(response.ImageBase64)
+	if err != nil {
+		t.Fatalf("Failed to decode image: %v", err)
+	}
+	return response, img
+}
+
+func pngBounds(t *testing.T, data []byte) image.Rectangle {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	return img.Bounds()
+}
+
+func TestGenerateQRCodeWithoutCaption(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	_, img := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:         "https://example.com",
+		HideCaption: true,
+	})
+	if b := pngBounds(t, img); b.Dx() != b.Dy() {
+		t.Errorf("Expected a square image without caption, got %v", b)
+	}
+}
+
+func TestGenerateQRCodeWithCustomCaptionAndFont(t *testing.T) {
+	t.Setenv("FONTS_DIR", "../../fonts")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	_, short := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:      "https://example.com",
+		Caption:  "Scan for menu",
+		Font:     "Go-Bold",
+		FontSize: 18,
+	})
+	_, long := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:      "https://example.com",
+		Caption:  "Scan for today's menu, opening hours and the wifi password",
+		Font:     "Go-Bold",
+		FontSize: 18,
+	})
+	if pngBounds(t, long).Dy() <= pngBounds(t, short).Dy() {
+		t.Errorf("Expected a long caption to wrap onto more lines")
+	}
+
+	_, svg := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:     "https://example.com",
+		Format:  "svg",
+		Caption: "Scan für das Menü",
+		Font:    "go-regular",
+	})
+	// outline fonts are written as glyph curves rather than pixel runs
+	if !strings.Contains(string(svg), "Q") {
+		t.Errorf("Expected glyph outlines in the SVG caption")
+	}
+}
+
+func TestGenerateQRCodeWithNonASCIICaption(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	response, img := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:     "https://example.com",
+		Caption: "Café Ελληνικά Привет",
+	})
+	if response.Caption != "Café Ελληνικά Привет" {
+		t.Errorf("Expected the caption to be stored, got %s", response.Caption)
+	}
+	if b := pngBounds(t, img); b.Dy() <= b.Dx() {
+		t.Errorf("Expected room for the caption, got %v", b)
+	}
+}
+
+func TestGenerateQRCodeWithInvalidCaptionOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	requests := []*models.QRCodeRequest{
+		{URL: "https://example.com", Font: "comic-sans"},
+		{URL: "https://example.com", FontSize: 200},
+		{URL: "https://example.com", Caption: strings.Repeat("a", 101)},
+	}
+	for _, req := range requests {
+		w := postQRCode(router, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", req, w.Code)
+		}
+	}
+}
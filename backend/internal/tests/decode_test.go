@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+	"github.com/skip2/go-qrcode"
+)
+
+func uploadForDecoding(router *gin.Engine, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("image", "photo.jpg")
+	part.Write(data)
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "/v1/qr/decode", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// place png images side by side on a white sheet, like a photo of several printed codes
+func photoOf(t *testing.T, images ...[]byte) []byte {
+	const gap = 60
+	var decoded []image.Image
+	width, height := gap, 0
+	for _, data := range images {
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decode PNG: %v", err)
+		}
+		decoded = append(decoded, img)
+		width += img.Bounds().Dx() + gap
+		if h := img.Bounds().Dy() + 2*gap; h > height {
+			height = h
+		}
+	}
+
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	x := gap
+	for _, img := range decoded {
+		draw.Draw(sheet, img.Bounds().Add(image.Pt(x, gap)), img, image.Point{}, draw.Over)
+		x += img.Bounds().Dx() + gap
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, sheet, &jpeg.Options{Quality: 85}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeQRCodesInPhoto(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.POST("/v1/qr/decode", handler.DecodeQRCode)
+
+	active, activePNG := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com/menu"})
+	expired, expiredPNG := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:          "https://example.com/offer",
+		ExpiresInSec: 60,
+		ModuleStyle:  "dots",
+	})
+	store.qrCodes[expired.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	store.qrCodes[active.ID].ScanCount = 7
+	foreignPNG, _ := qrcode.Encode("https://elsewhere.example.com/r/abc", qrcode.Medium, 256)
+
+	w := uploadForDecoding(router, photoOf(t, activePNG, expiredPNG, foreignPNG))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Symbols []models.DecodedSymbol `json:"symbols"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Symbols) != 3 {
+		t.Fatalf("Expected 3 symbols, got %+v", response.Symbols)
+	}
+
+	found := map[string]models.DecodedSymbol{}
+	for _, symbol := range response.Symbols {
+		found[symbol.Text] = symbol
+	}
+	if s := found["https://qr.example.com/r/"+active.ID]; s.QRCode == nil || s.QRCode.URL != "https://example.com/menu" || s.QRCode.ScanCount != 7 || s.Expired {
+		t.Errorf("Expected the active code to resolve with its scan count, got %+v", s)
+	}
+	if s := found["https://qr.example.com/r/"+expired.ID]; s.QRCode == nil || s.QRCode.ID != expired.ID || !s.Expired {
+		t.Errorf("Expected the expired code to resolve as expired, got %+v", s)
+	}
+	if s, ok := found["https://elsewhere.example.com/r/abc"]; !ok || s.QRCode != nil || s.ID != "" {
+		t.Errorf("Expected the foreign code to be returned without a qr code, got %+v", s)
+	}
+}
+
+func TestDecodeQRCodeOfUnknownID(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr/decode", handler.DecodeQRCode)
+
+	data, _ := qrcode.Encode("https://qr.example.com/r/deleted123", qrcode.Medium, 256)
+	w := uploadForDecoding(router, data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Symbols []models.DecodedSymbol `json:"symbols"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Symbols) != 1 || response.Symbols[0].ID != "deleted123" || response.Symbols[0].QRCode != nil {
+		t.Errorf("Expected the id without a qr code, got %+v", response.Symbols)
+	}
+}
+
+func TestDecodeImageWithoutQRCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr/decode", handler.DecodeQRCode)
+
+	w := uploadForDecoding(router, redSquarePNG())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if body := w.Body.String(); body != `{"symbols":[]}` {
+		t.Errorf("Expected no symbols, got %s", body)
+	}
+
+	w = uploadForDecoding(router, []byte("not an image"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a file that isn't an image, got %d", w.Code)
+	}
+}
+
+// a png that claims to be w by h pixels. only the header is rewritten, the image
+// data is that of a single pixel
+func pngClaimingSize(w, h uint32) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buf.Bytes()
+	// signature, then the length and type of the IHDR chunk
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+	return data
+}
+
+func TestDecodeRejectsOversizedImages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr/decode", handler.DecodeQRCode)
+
+	// every side is within bounds, the pixel count isn't
+	for _, size := range [][2]uint32{{6000, 5000}, {10000, 10000}, {100000, 300}} {
+		w := uploadForDecoding(router, pngClaimingSize(size[0], size[1]))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "megapixels") {
+			t.Errorf("Expected 400 for a %dx%d image, got %d: %s", size[0], size[1], w.Code, w.Body.String())
+		}
+	}
+
+	w := uploadForDecoding(router, make([]byte, services.MaxDecodeBytes+1<<20))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized upload, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// a plain square border, registered to check frames can be added from outside
+type squareFrame struct{}
+
+func (squareFrame) Layout(content image.Point) (image.Point, image.Point) {
+	return content.Add(image.Pt(40, 40)), image.Pt(20, 20)
+}
+
+func (squareFrame) Shapes(size image.Point, content image.Rectangle, p services.FrameParams) ([]services.Shape, error) {
+	border := &services.Path{}
+	border.Ring(0, 0, float32(size.X), float32(size.Y), 0, 4)
+	return []services.Shape{{Path: border, Color: p.Color}}, nil
+}
+
+func init() {
+	services.RegisterFrame("test-square", squareFrame{})
+}
+
+func TestGenerateQRCodeWithFrames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	_, plain := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com"})
+	plainBounds := pngBounds(t, plain)
+
+	for _, frame := range []string{"banner", "scan-me", "phone", "test-square"} {
+		response, data := createAndDecode(t, router, &models.QRCodeRequest{
+			URL:        "https://example.com",
+			Frame:      frame,
+			FrameColor: "#E53935",
+		})
+		if response.Frame != frame || response.FrameColor != "#e53935" {
+			t.Errorf("%s: unexpected frame options %q %q", frame, response.Frame, response.FrameColor)
+		}
+
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: failed to decode PNG: %v", frame, err)
+		}
+		b := img.Bounds()
+		if b.Dx() <= plainBounds.Dx() || b.Dy() <= plainBounds.Dy() {
+			t.Errorf("%s: expected the framed image to be larger than %v, got %v", frame, plainBounds, b)
+		}
+
+		// the frame border runs through the middle of the left edge
+		c := color.NRGBAModel.Convert(img.At(b.Min.X+2, b.Dy()/2)).(color.NRGBA)
+		if c.R < 0xc0 || c.G > 0x60 || c.B > 0x60 {
+			t.Errorf("%s: expected the frame color at the left edge, got %v", frame, c)
+		}
+	}
+}
+
+func TestGenerateQRCodeWithFrameInSVG(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	_, data := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:        "https://example.com",
+		Format:     "svg",
+		Frame:      "scan-me",
+		FrameColor: "#1e88e5",
+		FrameText:  "Open menu",
+	})
+	svg := string(data)
+	if !strings.Contains(svg, `fill="#1e88e5"`) {
+		t.Errorf("Expected a frame path in the frame color, got %s", svg)
+	}
+	if !strings.Contains(svg, `<g transform="translate(`) {
+		t.Errorf("Expected the code to be offset inside the frame")
+	}
+}
+
+func TestPhoneFrameTextIsReadableOnTheBackground(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	tests := []struct {
+		frameColor string
+		textFill   string
+	}{
+		// 3.7:1 on white scans but is too faint for text
+		{"#1e88e5", `fill="#000000"`},
+		{"#1a237e", `fill="#1a237e"`},
+	}
+	for _, tt := range tests {
+		_, data := createAndDecode(t, router, &models.QRCodeRequest{
+			URL:             "https://example.com",
+			Format:          "svg",
+			ForegroundColor: "#202020",
+			Frame:           "phone",
+			FrameColor:      tt.frameColor,
+		})
+		// the body is drawn first, then the text
+		paths := strings.SplitN(string(data), "<path ", 4)
+		if len(paths) < 3 || !strings.HasPrefix(paths[2], tt.textFill) {
+			t.Errorf("Expected the text of a %s phone frame drawn with %s, got %s", tt.frameColor, tt.textFill, data)
+		}
+	}
+}
+
+func TestGenerateQRCodeWithInvalidFrameOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	for _, req := range []*models.QRCodeRequest{
+		{URL: "https://example.com", Frame: "polaroid"},
+		{URL: "https://example.com", Frame: "banner", FrameColor: "red"},
+		{URL: "https://example.com", Frame: "phone", FrameColor: "#ffeb3b"},
+		{URL: "https://example.com", Frame: "banner", FrameText: strings.Repeat("x", 31)},
+	} {
+		if w := postQRCode(router, req); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for frame %q, got %d", req.Frame, w.Code)
+		}
+	}
+}
+
+func TestListFrames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/frames", handler.ListFrames)
+
+	w := getImage(router, "/v1/frames")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var response struct {
+		Frames []string `json:"frames"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	for _, frame := range []string{"banner", "phone", "scan-me", "test-square"} {
+		found := false
+		for _, name := range response.Frames {
+			found = found || name == frame
+		}
+		if !found {
+			t.Errorf("Expected %s in %v", frame, response.Frames)
+		}
+	}
+}
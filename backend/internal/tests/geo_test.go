@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// testdata/geo-test.mmdb maps 81.2.69.0/24 and 2a02:8100::/32 to DE,
+// 2.125.160.0/24 to GB and 216.160.83.0/24 to US
+const geoTestDB = "testdata/geo-test.mmdb"
+
+// where test requests come from, the way nginx would send them. gin.Default
+// trusts every proxy, so X-Real-IP from it is honored
+const proxyAddr = "10.0.0.1:51234"
+
+func scanFrom(t *testing.T, router *gin.Engine, id, realIP string) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/r/"+id, nil)
+	req.RemoteAddr = proxyAddr
+	if realIP != "" {
+		req.Header.Set("X-Real-IP", realIP)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected 302, got %d: %s", w.Code, w.Body.String())
+	}
+	return w.Header().Get("Location")
+}
+
+func TestRedirectRulesByCountry(t *testing.T) {
+	t.Setenv("GEOIP_DB", geoTestDB)
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL:  "https://example.com",
+		Slug: "regional",
+		RedirectRules: models.RedirectRules{
+			{Countries: []string{"de", "AT"}, URL: "https://example.de"},
+			{Countries: []string{"GB"}, Device: "mobile", URL: "https://m.example.co.uk"},
+		},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		realIP string
+		want   string
+	}{
+		{"germany", "81.2.69.142", "https://example.de"},
+		{"germany over ipv6", "2a02:8100::1", "https://example.de"},
+		{"britain on desktop", "2.125.160.216", "https://example.com"},
+		{"united states", "216.160.83.56", "https://example.com"},
+		{"not in the database", "192.0.2.1", "https://example.com"},
+		{"without x-real-ip", "", "https://example.com"},
+		{"invalid x-real-ip", "not an ip", "https://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanFrom(t, router, "regional", tt.realIP); got != tt.want {
+				t.Errorf("Expected a redirect to %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/r/regional", nil)
+	req.RemoteAddr = proxyAddr
+	req.Header.Set("X-Real-IP", "2.125.160.216")
+	req.Header.Set("User-Agent", androidUA)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Location"); got != "https://m.example.co.uk" {
+		t.Errorf("Expected country and device to combine, got %s", got)
+	}
+}
+
+func TestRedirectRulesByCountryWithoutDatabase(t *testing.T) {
+	t.Setenv("GEOIP_DB", "testdata/missing.mmdb")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL:           "https://example.com",
+		Slug:          "regional",
+		RedirectRules: models.RedirectRules{{Countries: []string{"DE"}, URL: "https://example.de"}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scanFrom(t, router, "regional", "81.2.69.142"); got != "https://example.com" {
+		t.Errorf("Expected the url when no database can be read, got %s", got)
+	}
+
+	w = postQRCode(router, &models.QRCodeRequest{
+		URL:           "https://example.com",
+		RedirectRules: models.RedirectRules{{Countries: []string{"Germany"}, URL: "https://example.de"}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a country name, got %d", w.Code)
+	}
+}
@@ -0,0 +1,410 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+var svgRun = regexp.MustCompile(`M(\d+) (\d+)h(\d+)v1h-\d+z`)
+
+// read the module grid back out of the first path of an svg image
+func svgModuleGrid(t *testing.T, svg string) [][]bool {
+	start := strings.Index(svg, `<path transform="scale(`)
+	if start < 0 {
+		t.Fatalf("SVG has no module path: %s", svg)
+	}
+	path := svg[start:]
+	path = path[:strings.Index(path, "/>")]
+
+	runs := svgRun.FindAllStringSubmatch(path, -1)
+	size := 0
+	for _, run := range runs {
+		x, _ := strconv.Atoi(run[1])
+		w, _ := strconv.Atoi(run[3])
+		if x+w > size {
+			size = x + w
+		}
+	}
+
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	for _, run := range runs {
+		x, _ := strconv.Atoi(run[1])
+		y, _ := strconv.Atoi(run[2])
+		w, _ := strconv.Atoi(run[3])
+		for i := x; i < x+w; i++ {
+			grid[y][i] = true
+		}
+	}
+	return grid
+}
+
+// sample the center pixel of every module of a png image
+func pngModuleGrid(img image.Image, modules int, qrSize int) [][]bool {
+	grid := make([][]bool, modules)
+	for y := range grid {
+		grid[y] = make([]bool, modules)
+		for x := range grid[y] {
+			px := int((float64(x) + 0.5) * float64(qrSize) / float64(modules))
+			py := int((float64(y) + 0.5) * float64(qrSize) / float64(modules))
+			r, _, _, _ := img.At(px, py).RGBA()
+			grid[y][x] = r < 0x8000
+		}
+	}
+	return grid
+}
+
+func getImage(router *gin.Engine, url string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSVGAndPNGModuleGridsMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	store.Save(&models.QRCode{ID: "test123", URL: "https://example.com"})
+
+	w := getImage(router, "/v1/qr/test123/image?format=svg")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("Expected image/svg+xml, got %s", ct)
+	}
+	svgGrid := svgModuleGrid(t, w.Body.String())
+
+	w = getImage(router, "/v1/qr/test123/image?format=png")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	pngGrid := pngModuleGrid(img, len(svgGrid), img.Bounds().Dx())
+
+	if len(svgGrid) < 21 {
+		t.Fatalf("Expected at least 21 modules, got %d", len(svgGrid))
+	}
+	for y := range svgGrid {
+		for x := range svgGrid[y] {
+			if svgGrid[y][x] != pngGrid[y][x] {
+				t.Fatalf("Module (%d, %d) differs: svg=%v png=%v", x, y, svgGrid[y][x], pngGrid[y][x])
+			}
+		}
+	}
+}
+
+func TestGenerateQRCodeWithSVGFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	jsonBody, _ := json.Marshal(&models.QRCodeRequest{
+		URL:    "https://example.com",
+		Format: "svg",
+	})
+
+	req, _ := http.NewRequest("POST", "/v1/qr", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", w.Code)
+	}
+
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if response.Format != "svg" {
+		t.Errorf("Expected format svg, got %s", response.Format)
+	}
+	img, err := base64.StdEncoding.DecodeString(response.ImageBase64)
+	if err != nil {
+		t.Fatalf("Failed to decode image: %v", err)
+	}
+	if !bytes.HasPrefix(img, []byte("<svg")) {
+		t.Errorf("Expected an SVG image, got %q", img[:10])
+	}
+}
+
+func TestGenerateQRCodeWithUnsupportedFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	jsonBody, _ := json.Marshal(&models.QRCodeRequest{
+		URL:    "https://example.com",
+		Format: "gif",
+	})
+
+	req, _ := http.NewRequest("POST", "/v1/qr", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
+
+func TestGetQRCodeRendersImageOnDemand(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/qr/:id", handler.GetQRCode)
+
+	store.Save(&models.QRCode{
+		ID:      "test123",
+		URL:     "https://example.com",
+		Options: models.RenderOptions{Format: "svg"},
+	})
+
+	for i := 0; i < 2; i++ {
+		w := getImage(router, "/v1/qr/test123")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+
+		var response models.QRCodeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		img, err := base64.StdEncoding.DecodeString(response.ImageBase64)
+		if err != nil {
+			t.Fatalf("Failed to decode image: %v", err)
+		}
+		if !bytes.HasPrefix(img, []byte("<svg")) {
+			t.Errorf("Expected the stored SVG format to be rendered, got %q", img[:10])
+		}
+	}
+}
+
+func TestGetQRCodeImageCachingHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	store.Save(&models.QRCode{ID: "test123", URL: "https://example.com"})
+
+	w := getImage(router, "/v1/qr/test123/image")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	etag := w.Header().Get("ETag")
+	if !regexp.MustCompile(`^"[0-9a-f]{32}"$`).MatchString(etag) {
+		t.Errorf("Expected a quoted hex ETag, got %q", etag)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Errorf("Expected Cache-Control public, max-age=86400, got %q", cc)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("Expected Vary: Accept, got %q", vary)
+	}
+	if again := getImage(router, "/v1/qr/test123/image"); again.Header().Get("ETag") != etag {
+		t.Errorf("Expected the same image to keep its ETag, got %q and %q", etag, again.Header().Get("ETag"))
+	}
+	if svg := getImage(router, "/v1/qr/test123/image?format=svg"); svg.Header().Get("ETag") == etag {
+		t.Errorf("Expected another format to have another ETag")
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/qr/test123/image", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching If-None-Match, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no body with 304, got %d bytes", w.Body.Len())
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("Expected the ETag to be repeated with 304, got %q", w.Header().Get("ETag"))
+	}
+
+	for _, match := range []string{`"stale", ` + etag, "W/" + etag, "*"} {
+		req, _ = http.NewRequest("GET", "/v1/qr/test123/image", nil)
+		req.Header.Set("If-None-Match", match)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("Expected 304 for If-None-Match %s, got %d", match, w.Code)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/qr/test123/image", nil)
+	req.Header.Set("If-None-Match", `"stale", W/"older"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("Expected 200 with the image for stale ETags, got %d", w.Code)
+	}
+}
+
+func TestGetQRCodeImageDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	store.Save(&models.QRCode{ID: "test123", URL: "https://example.com"})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/v1/qr/test123/image", ""},
+		{"/v1/qr/test123/image?download=1", `attachment; filename="qr-test123.png"`},
+		{"/v1/qr/test123/image?download=1&format=svg", `attachment; filename="qr-test123.svg"`},
+		{"/v1/qr/test123/image?download=1&format=jpeg", `attachment; filename="qr-test123.jpg"`},
+	}
+	for _, tt := range tests {
+		w := getImage(router, tt.url)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", tt.url, w.Code)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != tt.want {
+			t.Errorf("Expected Content-Disposition %q for %s, got %q", tt.want, tt.url, got)
+		}
+	}
+}
+
+func TestGetQRCodeImageFormatNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	store.Save(&models.QRCode{ID: "test123", URL: "https://example.com"})
+	store.Save(&models.QRCode{ID: "svg123", URL: "https://example.com", Options: models.RenderOptions{Format: "svg"}})
+
+	tests := []struct {
+		name   string
+		url    string
+		accept string
+		want   string
+	}{
+		{"stored format", "/v1/qr/svg123/image", "", "image/svg+xml"},
+		{"default format", "/v1/qr/test123/image", "", "image/png"},
+		{"accept svg", "/v1/qr/test123/image", "image/svg+xml", "image/svg+xml"},
+		{"accept jpeg", "/v1/qr/test123/image", "image/jpeg", "image/jpeg"},
+		{"highest q-value", "/v1/qr/test123/image", "text/html, image/jpeg;q=0.8, image/svg+xml", "image/svg+xml"},
+		{"explicit q-values", "/v1/qr/test123/image", "image/svg+xml;q=0.5, image/jpeg;q=0.9", "image/jpeg"},
+		{"first listed wins a tie", "/v1/qr/test123/image", "image/jpeg, image/svg+xml", "image/jpeg"},
+		{"q=0 rules a type out", "/v1/qr/svg123/image", "image/jpeg;q=0", "image/svg+xml"},
+		{"wildcards are ignored", "/v1/qr/svg123/image", "image/*, */*", "image/svg+xml"},
+		{"query beats accept", "/v1/qr/test123/image?format=png", "image/svg+xml", "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, ct)
+			}
+		})
+	}
+
+	w := getImage(router, "/v1/qr/test123/image?format=jpeg&size=128")
+	img, err := jpeg.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode JPEG: %v", err)
+	}
+	if img.Bounds().Dx() != 128 {
+		t.Errorf("Expected a 128px wide JPEG, got %d", img.Bounds().Dx())
+	}
+
+	if w := getImage(router, "/v1/qr/test123/image?format=gif"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unsupported format, got %d", w.Code)
+	}
+}
+
+func TestGetQRCodeImageSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	store.Save(&models.QRCode{ID: "test123", URL: "https://example.com"})
+
+	for _, size := range []string{"32", "63", "2049", "-1", "abc"} {
+		if w := getImage(router, "/v1/qr/test123/image?size="+size); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for size %s, got %d", size, w.Code)
+		}
+	}
+
+	for _, size := range []int{64, 512} {
+		w := getImage(router, "/v1/qr/test123/image?size="+strconv.Itoa(size))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for size %d, got %d", size, w.Code)
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to decode PNG: %v", err)
+		}
+		if img.Bounds().Dx() != size {
+			t.Errorf("Expected a %dpx wide image, got %d", size, img.Bounds().Dx())
+		}
+	}
+
+	if w := getImage(router, "/v1/qr/missing/image"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown code, got %d", w.Code)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func redSquarePNG() []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func uploadLogo(router *gin.Engine, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("logo", "logo.png")
+	part.Write(data)
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "/v1/logos", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUploadLogoIsStoredOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/logos", handler.UploadLogo)
+	router.GET("/v1/logos/:id", handler.GetLogo)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		w := uploadLogo(router, redSquarePNG())
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var logo models.Logo
+		if err := json.Unmarshal(w.Body.Bytes(), &logo); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		ids = append(ids, logo.ID)
+	}
+
+	if ids[0] != ids[1] {
+		t.Errorf("Expected the same logo ID for identical uploads, got %s and %s", ids[0], ids[1])
+	}
+	if len(store.logos) != 1 {
+		t.Errorf("Expected 1 stored logo, got %d", len(store.logos))
+	}
+
+	w := getImage(router, "/v1/logos/"+ids[0])
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected image/png, got %s", ct)
+	}
+}
+
+func TestUploadLogoWithInvalidImage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/logos", handler.UploadLogo)
+
+	w := uploadLogo(router, []byte("not an image"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
+
+func TestGenerateQRCodeWithLogo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/logos", handler.UploadLogo)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	w := uploadLogo(router, redSquarePNG())
+	var logo models.Logo
+	json.Unmarshal(w.Body.Bytes(), &logo)
+
+	w = postQRCode(router, &models.QRCodeRequest{
+		URL:             "https://example.com",
+		ErrorCorrection: "L",
+		LogoID:          logo.ID,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.ErrorCorrection != "H" {
+		t.Errorf("Expected a logo to force error correction H, got %s", response.ErrorCorrection)
+	}
+
+	img, _ := base64.StdEncoding.DecodeString(response.ImageBase64)
+	decoded, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	size := decoded.Bounds().Dx()
+	if r, g, b, _ := decoded.At(size/2, size/2).RGBA(); r>>8 != 0xff || g != 0 || b != 0 {
+		t.Errorf("Expected the logo in the center, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+	if r, _, _, _ := decoded.At(0, 0).RGBA(); r != 0 {
+		t.Errorf("Expected the finder pattern to stay visible")
+	}
+}
+
+func TestGenerateQRCodeWithUnknownLogo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL:    "https://example.com",
+		LogoID: "missing",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func postQRCode(router *gin.Engine, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/v1/qr", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGenerateQRCodeWithErrorCorrectionAndSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL:             "https://example.com",
+		ErrorCorrection: "h",
+		SizePx:          512,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.ErrorCorrection != "H" {
+		t.Errorf("Expected error correction H, got %s", response.ErrorCorrection)
+	}
+	if response.SizePx != 512 {
+		t.Errorf("Expected size 512, got %d", response.SizePx)
+	}
+
+	storedQR, err := store.FindByID(response.ID)
+	if err != nil {
+		t.Fatalf("Failed to get QR code from store: %v", err)
+	}
+	if storedQR.Options.ErrorCorrection != "H" || storedQR.Options.SizePx != 512 {
+		t.Errorf("Expected options to be stored, got %+v", storedQR.Options)
+	}
+
+	img, _ := base64.StdEncoding.DecodeString(response.ImageBase64)
+	decoded, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if decoded.Bounds().Dx() != 512 {
+		t.Errorf("Expected width 512, got %d", decoded.Bounds().Dx())
+	}
+}
+
+func TestGenerateQRCodeWithInvalidRenderOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	requests := []*models.QRCodeRequest{
+		{URL: "https://example.com", ErrorCorrection: "X"},
+		{URL: "https://example.com", SizePx: 16},
+		{URL: "https://example.com", SizePx: 10000},
+	}
+	for _, req := range requests {
+		w := postQRCode(router, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", req, w.Code)
+		}
+	}
+}
+
+func TestGenerateQRCodeWithColors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL:             "https://example.com",
+		ForegroundColor: "#1A237E",
+		BackgroundColor: "#FFF8E1",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.ForegroundColor != "#1a237e" || response.BackgroundColor != "#fff8e1" {
+		t.Errorf("Expected normalized colors, got %s and %s", response.ForegroundColor, response.BackgroundColor)
+	}
+
+	img, _ := base64.StdEncoding.DecodeString(response.ImageBase64)
+	decoded, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	// the top left corner is always part of a finder pattern
+	if r, g, b, _ := decoded.At(0, 0).RGBA(); r>>8 != 0x1a || g>>8 != 0x23 || b>>8 != 0x7e {
+		t.Errorf("Expected foreground color at the finder pattern, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+	bottom := decoded.Bounds().Max.Y - 1
+	if r, g, b, _ := decoded.At(0, bottom).RGBA(); r>>8 != 0xff || g>>8 != 0xf8 || b>>8 != 0xe1 {
+		t.Errorf("Expected background color below the code, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestGenerateQRCodeWithTransparentBackground(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL:         "https://example.com",
+		Transparent: true,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	img, _ := base64.StdEncoding.DecodeString(response.ImageBase64)
+	decoded, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if _, _, _, a := decoded.At(0, decoded.Bounds().Max.Y-1).RGBA(); a != 0 {
+		t.Errorf("Expected a transparent background, got alpha %d", a)
+	}
+	if _, _, _, a := decoded.At(0, 0).RGBA(); a != 0xffff {
+		t.Errorf("Expected opaque modules, got alpha %d", a)
+	}
+}
+
+func TestGenerateQRCodeRejectsUnscannableColors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	requests := []*models.QRCodeRequest{
+		// inverted
+		{URL: "https://example.com", ForegroundColor: "#ffffff", BackgroundColor: "#000000"},
+		// low contrast
+		{URL: "https://example.com", ForegroundColor: "#999999", BackgroundColor: "#aaaaaa"},
+		{URL: "https://example.com", ForegroundColor: "not-a-color"},
+	}
+	for _, req := range requests {
+		w := postQRCode(router, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", req, w.Code)
+		}
+		var response struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Error == "" {
+			t.Error("Expected error message, got empty string")
+		}
+	}
+}
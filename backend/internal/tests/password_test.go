@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+var promptToken = regexp.MustCompile(`name="token" value="([^"]*)"`)
+
+// scan a protected code and return the token of the password prompt
+func prompt(t *testing.T, router *gin.Engine, id string) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/r/"+id, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Fatalf("Expected the password prompt, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	m := promptToken.FindStringSubmatch(w.Body.String())
+	if m == nil || m[1] == "" {
+		t.Fatalf("Expected a token in the prompt, got %s", w.Body.String())
+	}
+	return m[1]
+}
+
+func unlock(router *gin.Engine, id, password, token, realIP string) *httptest.ResponseRecorder {
+	form := url.Values{"password": {password}, "token": {token}}
+	req, _ := http.NewRequest("POST", "/r/"+id, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = proxyAddr
+	req.Header.Set("X-Real-IP", realIP)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPasswordProtectedRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/scans", handler.GetScanCount)
+	router.GET("/r/:id", handler.HandleRedirect)
+	router.POST("/r/:id", handler.UnlockQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com/secret", Slug: "locked", Password: "hunter22"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "hunter22") || strings.Contains(w.Body.String(), "$2a$") {
+		t.Errorf("Expected neither the password nor its hash in the response, got %s", w.Body.String())
+	}
+	var created models.QRCodeResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !created.PasswordProtected {
+		t.Errorf("Expected the code to be marked as protected")
+	}
+	if !strings.HasPrefix(store.qrCodes["locked"].PasswordHash, "$2a$") {
+		t.Errorf("Expected a bcrypt hash to be stored, got %q", store.qrCodes["locked"].PasswordHash)
+	}
+
+	token := prompt(t, router, "locked")
+
+	if w := unlock(router, "locked", "wrong one", token, "192.0.2.1"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong password, got %d", w.Code)
+	} else if !strings.Contains(w.Body.String(), token) {
+		t.Errorf("Expected the prompt to keep its token after a wrong password")
+	}
+	w = unlock(router, "locked", "hunter22", token, "192.0.2.1")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "https://example.com/secret" {
+		t.Fatalf("Expected a 303 to the destination, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// a token unlocks once, posts without one from a counted scan are sent to scan again
+	for _, token := range []string{token, "", "forged"} {
+		w = unlock(router, "locked", "hunter22", token, "192.0.2.1")
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/r/locked" {
+			t.Errorf("Expected token %q to be sent back to the redirect, got %d to %q", token, w.Code, w.Header().Get("Location"))
+		}
+	}
+	if other := prompt(t, router, "locked"); other == token {
+		t.Errorf("Expected each scan to get its own token")
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/qr/locked/scans", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var scans map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &scans)
+	if scans["scan_count"] != float64(2) || scans["unlock_count"] != float64(1) {
+		t.Errorf("Expected 2 scans and 1 unlock, got %v", scans)
+	}
+}
+
+func TestPasswordAttemptsAreLimited(t *testing.T) {
+	t.Setenv("QR_UNLOCK_ATTEMPTS", "3")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+	router.POST("/r/:id", handler.UnlockQRCode)
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: "locked", Password: "hunter22"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	token := prompt(t, router, "locked")
+
+	for i := 0; i < 3; i++ {
+		if w := unlock(router, "locked", "guess", token, "192.0.2.1"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for guess %d, got %d", i+1, w.Code)
+		}
+	}
+	if w := unlock(router, "locked", "hunter22", token, "192.0.2.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 once the attempts are used up, got %d", w.Code)
+	}
+	if w := unlock(router, "locked", "hunter22", token, "192.0.2.2"); w.Code != http.StatusSeeOther {
+		t.Errorf("Expected other addresses to be unaffected, got %d", w.Code)
+	}
+	if store.qrCodes["locked"].UnlockCount != 1 {
+		t.Errorf("Expected 1 unlock, got %d", store.qrCodes["locked"].UnlockCount)
+	}
+}
+
+func TestPasswordValidationAndRemoval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.PATCH("/v1/qr/:id", handler.UpdateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+	router.POST("/r/:id", handler.UnlockQRCode)
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Password: "abc"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a short password, got %d", w.Code)
+	}
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: "locked", Password: "hunter22"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	empty := ""
+	if w := patchQRCode(router, "locked", models.QRCodeUpdate{Password: &empty}); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scanAs(t, router, "locked", ""); got != "https://example.com" {
+		t.Errorf("Expected a plain redirect once the password is removed, got %s", got)
+	}
+
+	// without a password posting is sent back to the redirect, where the scan is counted
+	w := unlock(router, "locked?table=7", "", "", "192.0.2.1")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/r/locked?table=7" {
+		t.Errorf("Expected a 303 back to the redirect, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if store.qrCodes["locked"].ScanCount != 1 {
+		t.Errorf("Expected the post not to count a scan, got %d", store.qrCodes["locked"].ScanCount)
+	}
+}
+
+func TestPasswordAttemptsIgnoreUntrustedAddresses(t *testing.T) {
+	t.Setenv("QR_UNLOCK_ATTEMPTS", "3")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.SetTrustedProxies(nil)
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+	router.POST("/r/:id", handler.UnlockQRCode)
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: "locked", Password: "hunter22"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	token := prompt(t, router, "locked")
+
+	// a client that isn't a trusted proxy can't pick a new address for each guess
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		if w := unlock(router, "locked", "guess", token, ip); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for guess %d, got %d", i+1, w.Code)
+		}
+	}
+	if w := unlock(router, "locked", "guess", token, "192.0.2.4"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 with a spoofed X-Real-IP, got %d", w.Code)
+	}
+}
+
+func TestPasswordAttemptsDontLockOutOtherScanners(t *testing.T) {
+	t.Setenv("QR_UNLOCK_ATTEMPTS", "3")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+	router.POST("/r/:id", handler.UnlockQRCode)
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: "locked", Password: "hunter22"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// more wrong guesses than any one code used to take, from addresses that
+	// each end up throttled
+	token := prompt(t, router, "locked")
+	for i := 1; i <= 17; i++ {
+		ip := fmt.Sprintf("192.0.2.%d", i)
+		for j := 0; j < 3; j++ {
+			if w := unlock(router, "locked", "guess", token, ip); w.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected 401 for guess %d from %s, got %d", j+1, ip, w.Code)
+			}
+		}
+		if w := unlock(router, "locked", "guess", token, ip); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected %s to be throttled, got %d", ip, w.Code)
+		}
+	}
+	if w := unlock(router, "locked", "hunter22", prompt(t, router, "locked"), "198.51.100.1"); w.Code != http.StatusSeeOther {
+		t.Errorf("Expected a scanner at another address to still unlock, got %d", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func postSheet(router *gin.Engine, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/v1/qr/sheet", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func pdfPageCount(pdf string) int {
+	return strings.Count(pdf, "/Type /Page\n")
+}
+
+func TestGetQRCodeImageAsPDF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	created, _ := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:         "https://example.com",
+		ModuleStyle: "rounded",
+		Frame:       "banner",
+		Caption:     "Menu",
+	})
+
+	w := getImage(router, "/v1/qr/"+created.ID+"/image?format=pdf&download=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Expected application/pdf, got %s", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, ".pdf") {
+		t.Errorf("Expected a .pdf download, got %s", cd)
+	}
+	pdf := w.Body.String()
+	if !strings.HasPrefix(pdf, "%PDF-") || pdfPageCount(pdf) != 1 {
+		t.Errorf("Expected a one page PDF")
+	}
+
+	// the same code always renders to the same bytes
+	again := getImage(router, "/v1/qr/"+created.ID+"/image?format=pdf&size=256")
+	if again.Body.String() != pdf {
+		t.Errorf("Expected the PDF to be deterministic")
+	}
+}
+
+func TestGenerateQRCodeWithPDFFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	response, data := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com", Format: "pdf"})
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Errorf("Expected a PDF image")
+	}
+	if !response.Verified {
+		t.Errorf("Expected the PDF code to be verified")
+	}
+}
+
+func TestCreateSheet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.POST("/v1/qr/sheet", handler.CreateSheet)
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		created, _ := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com", Caption: "Table"})
+		ids = append(ids, created.ID)
+	}
+
+	// avery l7160 is 3 by 7 labels on a4, a 2 by 2 letter sheet needs two pages
+	for _, tc := range []struct {
+		template models.LabelTemplate
+		pages    int
+	}{
+		{models.LabelTemplate{PageSize: "A4", Rows: 7, Columns: 3, MarginTopMM: 15.1, MarginBottomMM: 15.1, MarginLeftMM: 7.2, MarginRightMM: 7.2, ColumnGapMM: 2.5, PaddingMM: 2}, 1},
+		{models.LabelTemplate{PageSize: "letter", Rows: 2, Columns: 2}, 2},
+		{models.LabelTemplate{PageWidthMM: 100, PageHeightMM: 50, Rows: 1, Columns: 2}, 3},
+	} {
+		w := postSheet(router, models.SheetRequest{IDs: ids, Template: tc.template})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/pdf" {
+			t.Errorf("Expected application/pdf, got %s", ct)
+		}
+		if pages := pdfPageCount(w.Body.String()); pages != tc.pages {
+			t.Errorf("Expected %d pages for %+v, got %d", tc.pages, tc.template, pages)
+		}
+	}
+}
+
+func TestCreateSheetWithInvalidRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.POST("/v1/qr/sheet", handler.CreateSheet)
+
+	created, _ := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com"})
+	grid := models.LabelTemplate{Rows: 2, Columns: 2}
+
+	for _, req := range []models.SheetRequest{
+		{IDs: []string{}, Template: grid},
+		{IDs: []string{created.ID, "missing"}, Template: grid},
+		{IDs: []string{created.ID}, Template: models.LabelTemplate{Rows: 0, Columns: 2}},
+		{IDs: []string{created.ID}, Template: models.LabelTemplate{PageSize: "tabloid", Rows: 1, Columns: 1}},
+		{IDs: []string{created.ID}, Template: models.LabelTemplate{PageSize: "custom", Rows: 1, Columns: 1}},
+		{IDs: []string{created.ID}, Template: models.LabelTemplate{Rows: 1, Columns: 1, MarginLeftMM: 150, MarginRightMM: 100}},
+	} {
+		if w := postSheet(router, req); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", req, w.Code)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+	"github.com/skip2/go-qrcode"
+)
+
+// pixels per meter from the pHYs chunk of a png, 0 without one
+func pngDensity(data []byte) uint32 {
+	i := bytes.Index(data, []byte("pHYs"))
+	if i < 0 || len(data) < i+13 || data[i+12] != 1 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data[i+4:])
+}
+
+func TestGenerateQRCodeWithPrintSize(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	response, data := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:         "https://example.com",
+		WidthMM:     30,
+		DPI:         300,
+		HideCaption: true,
+	})
+	if response.WidthMM != 30 || response.DPI != 300 || response.SizePx != 0 {
+		t.Errorf("Expected width_mm 30 at 300 dpi without size_px, got %v %v %v", response.WidthMM, response.DPI, response.SizePx)
+	}
+	if !response.Verified {
+		t.Errorf("Expected the print code to be verified")
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	q, _ := qrcode.New("https://qr.example.com/r/"+response.ID, qrcode.Medium)
+	q.DisableBorder = true
+	modules := len(q.Bitmap()) + 8
+
+	// 30mm at 300 dpi is 354 pixels, rounded to a whole number of pixels per module
+	width := img.Bounds().Dx()
+	if width%modules != 0 {
+		t.Errorf("Expected a whole number of pixels per module, got %d pixels for %d modules", width, modules)
+	}
+	if math.Abs(float64(width)-354) > float64(modules)/2 {
+		t.Errorf("Expected about 354 pixels, got %d", width)
+	}
+
+	// the quiet zone is four modules of background
+	px := width / modules
+	for x := 0; x < 4*px; x++ {
+		if r, _, _, _ := img.At(x, 4*px).RGBA(); r != 0xffff {
+			t.Fatalf("Expected background in the quiet zone at %d", x)
+		}
+	}
+	if r, _, _, _ := img.At(4*px, 4*px).RGBA(); r != 0 {
+		t.Errorf("Expected the finder pattern right after the quiet zone")
+	}
+
+	// about 300 dpi, which is 11811 pixels per meter, adjusted to the whole pixel modules
+	if ppm := pngDensity(data); math.Abs(float64(ppm)-11811) > 11811*0.1 {
+		t.Errorf("Expected a pHYs chunk of about 11811 pixels per meter, got %d", ppm)
+	}
+}
+
+func TestPrintSizedCodeKeepsItsWidth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	svgWidth := regexp.MustCompile(`<svg [^>]*width="([0-9.]+)mm"`)
+	// small codes at low densities round their modules the furthest
+	for _, tt := range []struct {
+		widthMM float64
+		dpi     int
+	}{{30, 300}, {12, 150}, {7, 300}, {9.5, 96}} {
+		created, data := createAndDecode(t, router, &models.QRCodeRequest{
+			URL:         "https://example.com",
+			WidthMM:     tt.widthMM,
+			DPI:         tt.dpi,
+			HideCaption: true,
+		})
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decode PNG: %v", err)
+		}
+		px := float64(img.Bounds().Dx())
+		if mm := px / float64(pngDensity(data)) * 1000; math.Abs(mm-tt.widthMM) > 0.05 {
+			t.Errorf("Expected a %vmm png at %d dpi to print %vmm wide, got %.2fmm", tt.widthMM, tt.dpi, tt.widthMM, mm)
+		}
+
+		jpg := getImage(router, "/v1/qr/"+created.ID+"/image?format=jpeg").Body.Bytes()
+		i := bytes.Index(jpg, []byte("JFIF\x00"))
+		if i < 0 {
+			t.Fatalf("Expected a JFIF segment")
+		}
+		// jfif holds whole dots per inch, that is up to half a dot per inch off
+		dpi := float64(binary.BigEndian.Uint16(jpg[i+8:]))
+		if mm := px / dpi * 25.4; math.Abs(mm-tt.widthMM) > tt.widthMM*0.5/dpi {
+			t.Errorf("Expected a %vmm jpeg at %d dpi to print %vmm wide, got %.2fmm", tt.widthMM, tt.dpi, tt.widthMM, mm)
+		}
+
+		svg := getImage(router, "/v1/qr/"+created.ID+"/image?format=svg").Body.String()
+		m := svgWidth.FindStringSubmatch(svg)
+		if m == nil {
+			t.Fatalf("Expected the svg width in millimeters, got %s", svg[:120])
+		}
+		if mm, _ := strconv.ParseFloat(m[1], 64); math.Abs(mm-tt.widthMM) > 0.01 {
+			t.Errorf("Expected a %vmm svg, got %vmm", tt.widthMM, mm)
+		}
+	}
+}
+
+func TestGenerateQRCodeWithPrintSizeInOtherFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	created, _ := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:     "https://example.com",
+		WidthMM: 40,
+		DPI:     600,
+		Caption: "Table 4",
+	})
+
+	jpg := getImage(router, "/v1/qr/"+created.ID+"/image?format=jpeg").Body.Bytes()
+	if i := bytes.Index(jpg, []byte("JFIF\x00")); i < 0 || jpg[i+7] != 1 || math.Abs(float64(binary.BigEndian.Uint16(jpg[i+8:]))-600) > 600*0.1 {
+		t.Errorf("Expected a JFIF segment with about 600 dpi")
+	}
+
+	svg := getImage(router, "/v1/qr/"+created.ID+"/image?format=svg").Body.String()
+	if !strings.Contains(svg, `mm" height="`) {
+		t.Errorf("Expected the svg size in millimeters, got %s", svg[:120])
+	}
+
+	// a pixel size asks for a preview and replaces the printed width
+	preview := getImage(router, "/v1/qr/"+created.ID+"/image?size=128")
+	img, err := png.Decode(bytes.NewReader(preview.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 128 {
+		t.Errorf("Expected a 128 pixel preview, got %v", img.Bounds())
+	}
+}
+
+func TestGenerateQRCodeWithInvalidPrintSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	for _, req := range []*models.QRCodeRequest{
+		{URL: "https://example.com", WidthMM: 30, SizePx: 256},
+		{URL: "https://example.com", WidthMM: 30, DPI: 10},
+		{URL: "https://example.com", WidthMM: 1},
+		{URL: "https://example.com", WidthMM: 1000, DPI: 600},
+	} {
+		if w := postQRCode(router, req); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", req, w.Code)
+		}
+	}
+}
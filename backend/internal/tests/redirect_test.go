@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+const (
+	iPhoneUA        = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	iPadUA          = "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1"
+	androidUA       = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	androidTabletUA = "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	windowsUA       = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	macUA           = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15"
+	chromeOSUA      = "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	// desktop outlook names microsoft, which has "cros" in it
+	outlookUA    = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Microsoft Outlook 16.0.17425; Pro"
+	macOutlookUA = "Microsoft Office/16.0 (Macintosh; Mac OS X 14.4; Microsoft Outlook 16.84.24041420; Pro)"
+)
+
+// follow /r/id as the given browser and return where it is sent
+func scanAs(t *testing.T, router *gin.Engine, id, userAgent string) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/r/"+id, nil)
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected 302, got %d: %s", w.Code, w.Body.String())
+	}
+	return w.Header().Get("Location")
+}
+
+func TestRedirectRulesByDevice(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.PATCH("/v1/qr/:id", handler.UpdateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	const (
+		appStore = "https://apps.apple.com/app/id123"
+		play     = "https://play.google.com/store/apps/details?id=com.example"
+		tablets  = "https://example.com/tablet"
+		chromeOS = "https://example.com/chromebook"
+		web      = "https://example.com"
+	)
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL: web,
+		RedirectRules: models.RedirectRules{
+			{Device: "Tablet", URL: tablets},
+			{OS: "iOS", URL: appStore},
+			{OS: "android", URL: play},
+			{OS: "chromeos", URL: chromeOS},
+		},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(created.RedirectRules) != 4 || created.RedirectRules[1].OS != "ios" {
+		t.Errorf("Expected the normalized rules in the response, got %+v", created.RedirectRules)
+	}
+
+	// the tablet rule comes first so it wins over the os rules
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"iphone", iPhoneUA, appStore},
+		{"ipad", iPadUA, tablets},
+		{"android phone", androidUA, play},
+		{"android tablet", androidTabletUA, tablets},
+		{"windows", windowsUA, web},
+		{"mac", macUA, web},
+		{"chromebook", chromeOSUA, chromeOS},
+		{"outlook on windows", outlookUA, web},
+		{"outlook on mac", macOutlookUA, web},
+		{"no user agent", "", web},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanAs(t, router, created.ID, tt.userAgent); got != tt.want {
+				t.Errorf("Expected a redirect to %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if w := patchQRCode(router, created.ID, map[string]interface{}{
+		"redirect_rules": []map[string]string{{"device": "desktop", "url": "https://example.com/desktop"}},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scanAs(t, router, created.ID, windowsUA); got != "https://example.com/desktop" {
+		t.Errorf("Expected the updated rule to apply, got %s", got)
+	}
+	if got := scanAs(t, router, created.ID, iPhoneUA); got != web {
+		t.Errorf("Expected the old rules to be replaced, got %s", got)
+	}
+
+	if w := patchQRCode(router, created.ID, map[string]interface{}{"redirect_rules": []string{}}); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scanAs(t, router, created.ID, windowsUA); got != web {
+		t.Errorf("Expected an empty list to remove the rules, got %s", got)
+	}
+	if len(store.history) != 0 {
+		t.Errorf("Expected rule changes to leave the destination history alone, got %d entries", len(store.history))
+	}
+}
+
+func TestRedirectRulesWithInvalidRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	for _, rules := range []models.RedirectRules{
+		{{OS: "ios", URL: "not a url"}},
+		{{OS: "symbian", URL: "https://example.com"}},
+		{{Device: "watch", URL: "https://example.com"}},
+		{{URL: "https://example.com"}},
+	} {
+		w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", RedirectRules: rules})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", rules, w.Code)
+		}
+	}
+	if len(store.qrCodes) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d codes", len(store.qrCodes))
+	}
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func TestScanLimit(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qrify.example")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.PATCH("/v1/qr/:id", handler.UpdateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", MaxScans: -1}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative max_scans, got %d", w.Code)
+	}
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com/voucher", Slug: "voucher", MaxScans: 2})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		if got := scanAs(t, router, "voucher", ""); got != "https://example.com/voucher" {
+			t.Fatalf("Expected scan %d to reach the destination, got %s", i+1, got)
+		}
+	}
+	if got := scanAs(t, router, "voucher", ""); got != "https://qrify.example/exhausted" {
+		t.Errorf("Expected a used up code to go to the exhausted page, got %s", got)
+	}
+	if store.qrCodes["voucher"].ScanCount != 2 {
+		t.Errorf("Expected the scan count to stop at the limit, got %d", store.qrCodes["voucher"].ScanCount)
+	}
+
+	t.Setenv("QR_EXHAUSTED_URL", "https://example.com/sold-out")
+	if got := scanAs(t, router, "voucher", ""); got != "https://example.com/sold-out" {
+		t.Errorf("Expected the configured exhausted url, got %s", got)
+	}
+
+	more := 3
+	if w := patchQRCode(router, "voucher", models.QRCodeUpdate{MaxScans: &more}); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scanAs(t, router, "voucher", ""); got != "https://example.com/voucher" {
+		t.Errorf("Expected a raised limit to allow another scan, got %s", got)
+	}
+	if got := scanAs(t, router, "voucher", ""); got != "https://example.com/sold-out" {
+		t.Errorf("Expected the raised limit to be used up, got %s", got)
+	}
+}
+
+func TestScanLimitOfProtectedCode(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qrify.example")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+	router.POST("/r/:id", handler.UnlockQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com/voucher", Slug: "voucher", MaxScans: 1, Password: "hunter22"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	token := prompt(t, router, "voucher")
+	if w := unlock(router, "voucher", "hunter22", token, "192.0.2.1"); w.Header().Get("Location") != "https://example.com/voucher" {
+		t.Fatalf("Expected the first unlock to reach the destination, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// unlocking again needs another scan, which the used up voucher refuses
+	for _, token := range []string{token, ""} {
+		w := unlock(router, "voucher", "hunter22", token, "192.0.2.1")
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/r/voucher" {
+			t.Errorf("Expected a used token to be sent back to the redirect, got %d to %q", w.Code, w.Header().Get("Location"))
+		}
+	}
+	if got := scanAs(t, router, "voucher", ""); got != "https://qrify.example/exhausted" {
+		t.Errorf("Expected the used up voucher to go to the exhausted page, got %s", got)
+	}
+	if qr := store.qrCodes["voucher"]; qr.ScanCount != 1 || qr.UnlockCount != 1 {
+		t.Errorf("Expected 1 scan and 1 unlock, got %d and %d", qr.ScanCount, qr.UnlockCount)
+	}
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+const scheduleLayout = "2006-01-02T15:04:05"
+
+func TestScheduledDestinations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.PATCH("/v1/qr/:id", handler.UpdateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %v", err)
+	}
+	now := time.Now().In(tokyo)
+	launch := now.Add(-time.Hour).Format(scheduleLayout)
+	archive := now.Add(time.Hour).Format(scheduleLayout)
+
+	// listed out of order, they are sorted by start
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL: "https://example.com",
+		Schedule: &models.Schedule{
+			Timezone: "Asia/Tokyo",
+			Windows: []models.ScheduleWindow{
+				{Start: archive, URL: "https://example.com/archive"},
+				{End: launch, URL: "https://example.com/soon"},
+				{Start: launch, End: archive, URL: "https://example.com/live"},
+			},
+		},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if created.Schedule == nil || len(created.Schedule.Windows) != 3 {
+		t.Fatalf("Expected the schedule in the response, got %+v", created.Schedule)
+	}
+	if got := created.Schedule.Windows[0].URL; got != "https://example.com/soon" {
+		t.Errorf("Expected the windows sorted by start, got %s first", got)
+	}
+
+	// the same wall clock times in utc are hours away, so only the timezone makes this match
+	if got := scanAs(t, router, created.ID, ""); got != "https://example.com/live" {
+		t.Errorf("Expected the live page, got %s", got)
+	}
+
+	// times with an offset are moved into the schedule's timezone
+	start := time.Now().UTC().Add(-2 * time.Hour)
+	w = patchQRCode(router, created.ID, map[string]interface{}{
+		"schedule": map[string]interface{}{
+			"timezone": "Asia/Tokyo",
+			"windows": []map[string]string{
+				{"start": start.Format(time.RFC3339), "end": start.Add(time.Hour).Format(time.RFC3339), "url": "https://example.com/over"},
+			},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if want := start.In(tokyo).Format(scheduleLayout); updated.Schedule == nil || updated.Schedule.Windows[0].Start != want {
+		t.Errorf("Expected the start as Tokyo time %s, got %+v", want, updated.Schedule)
+	}
+	if got := scanAs(t, router, created.ID, ""); got != "https://example.com" {
+		t.Errorf("Expected the url once every window is over, got %s", got)
+	}
+
+	if w := patchQRCode(router, created.ID, map[string]interface{}{"schedule": map[string]interface{}{"windows": []string{}}}); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if store.qrCodes[created.ID].Schedule.Windows != nil {
+		t.Errorf("Expected an empty list to remove the schedule, got %+v", store.qrCodes[created.ID].Schedule)
+	}
+}
+
+func TestScheduleWithInvalidWindows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	tests := []struct {
+		name     string
+		schedule models.Schedule
+	}{
+		{"overlapping", models.Schedule{Windows: []models.ScheduleWindow{
+			{Start: "2030-01-01T00:00", End: "2030-02-01T00:00", URL: "https://example.com/a"},
+			{Start: "2030-01-15T00:00", End: "2030-03-01T00:00", URL: "https://example.com/b"},
+		}}},
+		{"two open starts", models.Schedule{Windows: []models.ScheduleWindow{
+			{End: "2030-01-01", URL: "https://example.com/a"},
+			{End: "2030-02-01", URL: "https://example.com/b"},
+		}}},
+		{"open end before another window", models.Schedule{Windows: []models.ScheduleWindow{
+			{Start: "2030-01-01", URL: "https://example.com/a"},
+			{Start: "2031-01-01", End: "2031-02-01", URL: "https://example.com/b"},
+		}}},
+		{"ends before it starts", models.Schedule{Windows: []models.ScheduleWindow{
+			{Start: "2030-02-01", End: "2030-01-01", URL: "https://example.com/a"},
+		}}},
+		{"unknown timezone", models.Schedule{Timezone: "Mars/Olympus", Windows: []models.ScheduleWindow{
+			{Start: "2030-01-01", URL: "https://example.com/a"},
+		}}},
+		{"invalid time", models.Schedule{Windows: []models.ScheduleWindow{
+			{Start: "next tuesday", URL: "https://example.com/a"},
+		}}},
+		{"invalid url", models.Schedule{Windows: []models.ScheduleWindow{
+			{Start: "2030-01-01", URL: "not a url"},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Schedule: &tt.schedule})
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// windows that only touch don't overlap
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Schedule: &models.Schedule{
+		Windows: []models.ScheduleWindow{
+			{End: "2030-01-01", URL: "https://example.com/a"},
+			{Start: "2030-01-01", URL: "https://example.com/b"},
+		},
+	}})
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected 201 for adjacent windows, got %d: %s", w.Code, w.Body.String())
+	}
+}
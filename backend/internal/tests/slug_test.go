@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func TestGenerateQRCodeWithSlug(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	created, img := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com", Slug: "Spring-Sale_2025"})
+	if created.ID != "Spring-Sale_2025" {
+		t.Errorf("Expected the slug as ID, got %s", created.ID)
+	}
+	if text := decodePNG(t, img); text != "https://qr.example.com/r/Spring-Sale_2025" {
+		t.Errorf("Expected the code to point at the slug, got %s", text)
+	}
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com/other", Slug: "Spring-Sale_2025"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a taken slug, got %d: %s", w.Code, w.Body.String())
+	}
+	if store.qrCodes["Spring-Sale_2025"].URL != "https://example.com" {
+		t.Error("Expected the existing code to be left alone")
+	}
+}
+
+func TestGenerateQRCodeWithInvalidSlug(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	for _, slug := range []string{"ab", "has space", "-leading", "trailing_", "sl/ash", "ünïcode", "decode", "Metrics", "trash", "Trash", string(make([]byte, 65))} {
+		w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: slug})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for slug %q, got %d", slug, w.Code)
+		}
+	}
+	if len(store.qrCodes) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d codes", len(store.qrCodes))
+	}
+}
+
+func TestGenerateQRCodeWithConfiguredIDFormat(t *testing.T) {
+	t.Setenv("QR_ID_ALPHABET", "base62")
+	t.Setenv("QR_ID_LENGTH", "8")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9A-Za-z]{8}$`).MatchString(response.ID) {
+		t.Errorf("Expected an 8 character base62 ID, got %s", response.ID)
+	}
+}
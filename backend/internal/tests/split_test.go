@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func createSplit(t *testing.T, router *gin.Engine, split models.Split) models.QRCodeResponse {
+	t.Helper()
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Split: &split})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var response models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return response
+}
+
+func TestSplitRedirectsByWeight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/scans", handler.GetScanCount)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	created := createSplit(t, router, models.Split{Variants: []models.Variant{
+		{URL: "https://example.com/a", Weight: 80},
+		{URL: "https://example.com/b", Weight: 20},
+	}})
+	if created.Split == nil || created.Split.Variants[0].Name != "a" || created.Split.Variants[1].Name != "b" {
+		t.Fatalf("Expected the variants to be named a and b, got %+v", created.Split)
+	}
+
+	const scans = 500
+	got := map[string]int{}
+	for i := 0; i < scans; i++ {
+		got[scanAs(t, router, created.ID, "")]++
+	}
+	// far outside what chance allows for 500 scans at 80/20
+	if share := float64(got["https://example.com/a"]) / scans; share < 0.7 || share > 0.9 {
+		t.Errorf("Expected about 80%% of scans on variant a, got %.0f%%", share*100)
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/qr/"+created.ID+"/scans", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var analytics struct {
+		ScanCount int                       `json:"scan_count"`
+		Variants  []models.VariantScanCount `json:"variants"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &analytics); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if analytics.ScanCount != scans || len(analytics.Variants) != 2 {
+		t.Fatalf("Expected %d scans over 2 variants, got %+v", scans, analytics)
+	}
+	for _, v := range analytics.Variants {
+		if v.ScanCount != got[v.URL] {
+			t.Errorf("Expected variant %s to count %d scans, got %d", v.Name, got[v.URL], v.ScanCount)
+		}
+	}
+}
+
+func TestSplitWithStickyCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	created := createSplit(t, router, models.Split{Sticky: true, Variants: []models.Variant{
+		{Name: "blue", URL: "https://example.com/blue"},
+		{Name: "green", URL: "https://example.com/green"},
+	}})
+
+	req, _ := http.NewRequest("GET", "/r/"+created.ID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	first := w.Header().Get("Location")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a variant cookie, got %v", cookies)
+	}
+	if cookies[0].Path != "/r/"+created.ID || !cookies[0].HttpOnly {
+		t.Errorf("Expected an http only cookie for the redirect path, got %+v", cookies[0])
+	}
+
+	for i := 0; i < 20; i++ {
+		req, _ := http.NewRequest("GET", "/r/"+created.ID, nil)
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if got := w.Header().Get("Location"); got != first {
+			t.Fatalf("Expected a returning scanner to stay on %s, got %s", first, got)
+		}
+	}
+	if counts := store.variantScans[created.ID]; counts["blue"]+counts["green"] != 21 {
+		t.Errorf("Expected every scan to record its variant, got %v", counts)
+	}
+}
+
+func TestSplitWithInvalidVariants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	for _, variants := range [][]models.Variant{
+		{{URL: "https://example.com/a"}},
+		{{Name: "x", URL: "https://example.com/a"}, {Name: "x", URL: "https://example.com/b"}},
+		{{URL: "https://example.com/a", Weight: -1}, {URL: "https://example.com/b"}},
+		{{Name: "has space", URL: "https://example.com/a"}, {URL: "https://example.com/b"}},
+		{{URL: "not a url"}, {URL: "https://example.com/b"}},
+	} {
+		w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Split: &models.Split{Variants: variants}})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", variants, w.Code)
+		}
+	}
+}
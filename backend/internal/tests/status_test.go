@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func switchStatus(t *testing.T, router *gin.Engine, id, action string) models.QRCodeResponse {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/v1/qr/"+id+"/"+action, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from %s, got %d: %s", action, w.Code, w.Body.String())
+	}
+	var resp models.QRCodeResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestQRCodeLifecycle(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qrify.example")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr", handler.GetQRCodeByURL)
+	router.GET("/v1/qr/:id", handler.GetQRCode)
+	router.POST("/v1/qr/:id/pause", handler.PauseQRCode)
+	router.POST("/v1/qr/:id/resume", handler.ResumeQRCode)
+	router.POST("/v1/qr/:id/archive", handler.ArchiveQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com/menu", Slug: "menu"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.QRCodeResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Status != models.StatusActive {
+		t.Errorf("Expected a new code to be active, got %q", created.Status)
+	}
+	scanAs(t, router, "menu", "")
+
+	if resp := switchStatus(t, router, "menu", "pause"); resp.Status != models.StatusPaused {
+		t.Errorf("Expected paused, got %q", resp.Status)
+	}
+	if got := scanAs(t, router, "menu", ""); got != "https://qrify.example/paused" {
+		t.Errorf("Expected the holding page, got %s", got)
+	}
+	t.Setenv("QR_PAUSED_URL", "https://example.com/back-soon")
+	if got := scanAs(t, router, "menu", ""); got != "https://example.com/back-soon" {
+		t.Errorf("Expected the configured holding page, got %s", got)
+	}
+	if store.qrCodes["menu"].ScanCount != 1 {
+		t.Errorf("Expected scans of a paused code not to count, got %d", store.qrCodes["menu"].ScanCount)
+	}
+
+	switchStatus(t, router, "menu", "resume")
+	if got := scanAs(t, router, "menu", ""); got != "https://example.com/menu" {
+		t.Errorf("Expected a resumed code to redirect again, got %s", got)
+	}
+
+	switchStatus(t, router, "menu", "archive")
+	if got := scanAs(t, router, "menu", ""); got != "https://qrify.example/expiration" {
+		t.Errorf("Expected an archived code to be retired, got %s", got)
+	}
+	req, _ := http.NewRequest("GET", "/v1/qr?url=https://example.com/menu", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected an archived code to be hidden from lookups, got %d", w.Code)
+	}
+	req, _ = http.NewRequest("GET", "/v1/qr/menu", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var archived models.QRCodeResponse
+	json.Unmarshal(w.Body.Bytes(), &archived)
+	if w.Code != http.StatusOK || archived.ScanCount != 2 {
+		t.Errorf("Expected an archived code to keep its scans, got %d with %d scans", w.Code, archived.ScanCount)
+	}
+
+	req, _ = http.NewRequest("POST", "/v1/qr/missing/pause", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown code, got %d", w.Code)
+	}
+}
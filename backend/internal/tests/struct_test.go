@@ -2,53 +2,184 @@ package tests
 
 import (
 	"errors"
+	"sort"
+	"time"
 
 	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
 )
 
 // MockQRCodeStore implements services.QRCodeStore
 type MockQRCodeStore struct {
 	qrCodes map[string]*models.QRCode
+	logos   map[string]*models.Logo
+	history []models.DestinationChange
+	// scans per code and variant
+	variantScans map[string]map[string]int
 }
 
 func NewMockQRCodeStore() *MockQRCodeStore {
 	return &MockQRCodeStore{
-		qrCodes: make(map[string]*models.QRCode),
+		qrCodes:      make(map[string]*models.QRCode),
+		logos:        make(map[string]*models.Logo),
+		variantScans: make(map[string]map[string]int),
 	}
 }
 
 func (m *MockQRCodeStore) Save(qr *models.QRCode) error {
+	if _, ok := m.qrCodes[qr.ID]; ok {
+		return services.ErrIDTaken
+	}
 	m.qrCodes[qr.ID] = qr
 	return nil
 }
 
-func (m *MockQRCodeStore) FindByID(id string) (*models.QRCode, error) {
+// the code unless it is missing or in the trash
+func (m *MockQRCodeStore) live(id string) (*models.QRCode, bool) {
 	qr, ok := m.qrCodes[id]
+	return qr, ok && qr.DeletedAt == nil
+}
+
+func (m *MockQRCodeStore) FindByID(id string) (*models.QRCode, error) {
+	qr, ok := m.live(id)
 	if !ok {
 		return nil, errors.New("QR code not found")
 	}
 	return qr, nil
 }
 
-func (m *MockQRCodeStore) DeleteByID(id string) error {
-	delete(m.qrCodes, id)
+func (m *MockQRCodeStore) DeleteByID(id string, at time.Time) error {
+	if qr, ok := m.live(id); ok {
+		qr.DeletedAt = &at
+	}
 	return nil
 }
 
+func (m *MockQRCodeStore) RestoreByID(id string) error {
+	qr, ok := m.qrCodes[id]
+	if !ok || qr.DeletedAt == nil {
+		return errors.New("QR code not found")
+	}
+	qr.DeletedAt = nil
+	return nil
+}
+
+func (m *MockQRCodeStore) FindTrashed() ([]*models.QRCode, error) {
+	trashed := []*models.QRCode{}
+	for _, qr := range m.qrCodes {
+		if qr.DeletedAt != nil {
+			trashed = append(trashed, qr)
+		}
+	}
+	sort.Slice(trashed, func(i, j int) bool { return trashed[i].DeletedAt.After(*trashed[j].DeletedAt) })
+	return trashed, nil
+}
+
+func (m *MockQRCodeStore) PurgeTrashed(before time.Time) (int64, error) {
+	var n int64
+	for id, qr := range m.qrCodes {
+		if qr.DeletedAt == nil || !qr.DeletedAt.Before(before) {
+			continue
+		}
+		delete(m.qrCodes, id)
+		delete(m.variantScans, id)
+		history := m.history[:0]
+		for _, change := range m.history {
+			if change.QRCodeID != id {
+				history = append(history, change)
+			}
+		}
+		m.history = history
+		n++
+	}
+	return n, nil
+}
+
 func (m *MockQRCodeStore) FindByURL(url string) (*models.QRCode, error) {
 	for _, qr := range m.qrCodes {
-		if qr.URL == url {
+		if qr.URL == url && qr.Status != models.StatusArchived && qr.DeletedAt == nil {
 			return qr, nil
 		}
 	}
 	return nil, nil
 }
 
-func (m *MockQRCodeStore) IncrementScanCount(id string) error {
-	qr, ok := m.qrCodes[id]
+func (m *MockQRCodeStore) Update(qr *models.QRCode, change *models.DestinationChange) error {
+	if _, ok := m.live(qr.ID); !ok {
+		return errors.New("QR code not found")
+	}
+	m.qrCodes[qr.ID] = qr
+	if change == nil {
+		return nil
+	}
+	change.ID = int64(len(m.history) + 1)
+	m.history = append(m.history, *change)
+	return nil
+}
+
+func (m *MockQRCodeStore) SetStatus(id, status string) error {
+	qr, ok := m.live(id)
 	if !ok {
 		return errors.New("QR code not found")
 	}
+	qr.Status = status
+	return nil
+}
+
+func (m *MockQRCodeStore) FindDestinationHistory(id string) ([]models.DestinationChange, error) {
+	history := []models.DestinationChange{}
+	for _, change := range m.history {
+		if change.QRCodeID == id {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+func (m *MockQRCodeStore) IncrementScanCount(id string) (bool, error) {
+	qr, ok := m.qrCodes[id]
+	if !ok {
+		return false, errors.New("QR code not found")
+	}
+	if qr.MaxScans > 0 && qr.ScanCount >= qr.MaxScans {
+		return false, nil
+	}
 	qr.ScanCount++
+	return true, nil
+}
+
+func (m *MockQRCodeStore) IncrementUnlockCount(id string) error {
+	qr, ok := m.qrCodes[id]
+	if !ok {
+		return errors.New("QR code not found")
+	}
+	qr.UnlockCount++
+	return nil
+}
+
+func (m *MockQRCodeStore) IncrementVariantScanCount(id, variant string) error {
+	if m.variantScans[id] == nil {
+		m.variantScans[id] = map[string]int{}
+	}
+	m.variantScans[id][variant]++
 	return nil
 }
+
+func (m *MockQRCodeStore) FindVariantScanCounts(id string) (map[string]int, error) {
+	counts := map[string]int{}
+	for variant, count := range m.variantScans[id] {
+		counts[variant] = count
+	}
+	return counts, nil
+}
+
+func (m *MockQRCodeStore) SaveLogo(logo *models.Logo) error {
+	if _, ok := m.logos[logo.ID]; !ok {
+		m.logos[logo.ID] = logo
+	}
+	return nil
+}
+
+func (m *MockQRCodeStore) FindLogo(id string) (*models.Logo, error) {
+	return m.logos[id], nil
+}
@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+	xdraw "golang.org/x/image/draw"
+)
+
+// the detector misjudges the module size of a few codes at some pixel sizes and
+// quiet zones, and the data of a few others throws off its search for the finder
+// patterns of an upright code. like a scanner, and the service, a code that doesn't
+// decode is tried again turned a quarter and at these scales and quiet zones
+var (
+	decodeScales     = []float64{1, 0.75, 1.5, 2, 0.5}
+	decodeQuietZones = []int{8, 6, 4}
+)
+
+// decode the qr code in a png image. the image is put on white with a quiet zone
+// around it, the way it would be printed
+func decodePNG(t *testing.T, data []byte) string {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	for _, scale := range decodeScales {
+		for _, div := range decodeQuietZones {
+			for _, turn := range []bool{false, true} {
+				if text, ok := decodeScaled(t, img, scale, div, turn); ok {
+					return text
+				}
+			}
+		}
+	}
+	t.Fatalf("Failed to decode QR code at any scale")
+	return ""
+}
+
+// decode img scaled by scale on white with a quiet zone of width/div, turned a
+// quarter clockwise if turn is set
+func decodeScaled(t *testing.T, img image.Image, scale float64, div int, turn bool) (string, bool) {
+	t.Helper()
+	b := img.Bounds()
+	w, h := int(float64(b.Dx())*scale), int(float64(b.Dy())*scale)
+	quiet := w / div
+	canvas := image.NewNRGBA(image.Rect(0, 0, w+2*quiet, h+2*quiet))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	xdraw.ApproxBiLinear.Scale(canvas, image.Rect(quiet, quiet, quiet+w, quiet+h), img, b, draw.Over, nil)
+	if turn {
+		cb := canvas.Bounds()
+		turned := image.NewNRGBA(image.Rect(0, 0, cb.Dy(), cb.Dx()))
+		for y := 0; y < cb.Dy(); y++ {
+			for x := 0; x < cb.Dx(); x++ {
+				turned.SetNRGBA(cb.Dy()-1-y, x, canvas.NRGBAAt(x, y))
+			}
+		}
+		canvas = turned
+	}
+
+	bmp, err := gozxing.NewBinaryBitmapFromImage(canvas)
+	if err != nil {
+		t.Fatalf("Failed to binarize image: %v", err)
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	})
+	if err != nil {
+		return "", false
+	}
+	return result.GetText(), true
+}
+
+func TestGenerateQRCodeWithModuleStylesDecodes(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	styles := []string{"square", "rounded", "dots"}
+	for _, moduleStyle := range styles {
+		for _, finderStyle := range styles {
+			for _, size := range []int{64, 256} {
+				response, data := createAndDecode(t, router, &models.QRCodeRequest{
+					URL:         "https://example.com",
+					SizePx:      size,
+					ModuleStyle: moduleStyle,
+					FinderStyle: finderStyle,
+					HideCaption: true,
+				})
+				if response.ModuleStyle != moduleStyle || response.FinderStyle != finderStyle {
+					t.Errorf("Expected styles %s/%s, got %s/%s", moduleStyle, finderStyle, response.ModuleStyle, response.FinderStyle)
+				}
+				if text := decodePNG(t, data); text != "https://qr.example.com"+response.QRCodeURL {
+					t.Errorf("%s modules with %s finders at %dpx decoded to %q, expected %q", moduleStyle, finderStyle, size, text, response.QRCodeURL)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateQRCodeWithStyledLogoAndColorsDecodes(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.POST("/v1/logos", handler.UploadLogo)
+
+	logo := uploadLogo(router, redSquarePNG())
+	if logo.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 uploading the logo, got %d", logo.Code)
+	}
+	var uploaded models.Logo
+	if err := json.Unmarshal(logo.Body.Bytes(), &uploaded); err != nil {
+		t.Fatalf("Failed to parse logo: %v", err)
+	}
+
+	response, data := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:             "https://example.com",
+		ModuleStyle:     "dots",
+		FinderStyle:     "rounded",
+		ForegroundColor: "#1a237e",
+		FinderColor:     "#c62828",
+		LogoID:          uploaded.ID,
+		Frame:           "banner",
+	})
+	if response.FinderColor != "#c62828" {
+		t.Errorf("Expected finder color #c62828, got %s", response.FinderColor)
+	}
+	if text := decodePNG(t, data); text != "https://qr.example.com"+response.QRCodeURL {
+		t.Errorf("Decoded %q, expected %q", text, response.QRCodeURL)
+	}
+}
+
+func TestGenerateQRCodeWithStylesInSVG(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	_, data := createAndDecode(t, router, &models.QRCodeRequest{
+		URL:         "https://example.com",
+		Format:      "svg",
+		ModuleStyle: "dots",
+		FinderStyle: "dots",
+		FinderColor: "#c62828",
+	})
+	svg := string(data)
+	if strings.Contains(svg, `transform="scale(`) {
+		t.Errorf("Expected dots to be drawn as curves, not module runs")
+	}
+	if !strings.Contains(svg, `<path fill="#c62828" d="M`) {
+		t.Errorf("Expected a finder path in the finder color")
+	}
+}
+
+func TestGenerateQRCodeWithInvalidStyles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	for _, req := range []*models.QRCodeRequest{
+		{URL: "https://example.com", ModuleStyle: "hearts"},
+		{URL: "https://example.com", FinderStyle: "stars"},
+		{URL: "https://example.com", FinderColor: "#eeeeee"},
+	} {
+		if w := postQRCode(router, req); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v, got %d", req, w.Code)
+		}
+	}
+}
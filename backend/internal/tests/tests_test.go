@@ -417,7 +417,7 @@ func TestGetScanCountAfterIncrement(t *testing.T) {
 		t.Fatalf("Failed to save QR code: %v", err)
 	}
 
-	err = store.IncrementScanCount("test123")
+	_, err = store.IncrementScanCount("test123")
 	if err != nil {
 		t.Fatalf("Failed to increment scan count: %v", err)
 	}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// turn a grid of light modules into a png with 4 pixels per module
+func lightGridPNG(light [][]bool) []byte {
+	const scale = 4
+	img := image.NewGray(image.Rect(0, 0, len(light[0])*scale, len(light)*scale))
+	for y := range light {
+		for x := range light[y] {
+			c := color.Gray{}
+			if light[y][x] {
+				c.Y = 0xff
+			}
+			for i := 0; i < scale*scale; i++ {
+				img.SetGray(x*scale+i%scale, y*scale+i/scale, c)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestGetQRCodeImageAsText(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	created, _ := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com", Caption: "Ops"})
+
+	w := getImage(router, "/v1/qr/"+created.ID+"/image?format=txt")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Expected text/plain, got %s", ct)
+	}
+
+	lines := strings.Split(strings.TrimRight(w.Body.String(), "\n"), "\n")
+	if caption := strings.TrimSpace(lines[len(lines)-1]); caption != "Ops" {
+		t.Errorf("Expected the caption below the code, got %q", caption)
+	}
+	// every character holds two module rows, blocks are the light modules
+	var light [][]bool
+	for _, line := range lines[:len(lines)-1] {
+		top, bottom := []bool{}, []bool{}
+		for _, r := range line {
+			top = append(top, r == '█' || r == '▀')
+			bottom = append(bottom, r == '█' || r == '▄')
+		}
+		light = append(light, top, bottom)
+	}
+	// an odd number of module rows leaves half of the last line below the code,
+	// the terminal background and not a dark row
+	light = light[:len(light[0])]
+	if text := decodePNG(t, lightGridPNG(light)); text != "https://qr.example.com/r/"+created.ID {
+		t.Errorf("Text code decoded to %q", text)
+	}
+}
+
+func TestGetQRCodeImageAsASCII(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://qr.example.com")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	created, _ := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com", HideCaption: true})
+
+	w := getImage(router, "/v1/qr/"+created.ID+"/image?format=ascii")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, r := range body {
+		if r > 127 {
+			t.Fatalf("Expected plain ascii, got %q", r)
+		}
+	}
+
+	var light [][]bool
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		row := []bool{}
+		for i := 0; i+1 < len(line); i += 2 {
+			row = append(row, line[i:i+2] != "##")
+		}
+		light = append(light, row)
+	}
+	if text := decodePNG(t, lightGridPNG(light)); text != "https://qr.example.com/r/"+created.ID {
+		t.Errorf("ASCII code decoded to %q", text)
+	}
+}
+
+func TestGetQRCodeImageNegotiatesText(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	created, _ := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com"})
+
+	req, _ := http.NewRequest("GET", "/v1/qr/"+created.ID+"/image", nil)
+	req.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "█") {
+		t.Errorf("Expected the half block code for text/plain, got %s", w.Body.String())
+	}
+}
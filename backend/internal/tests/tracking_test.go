@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func TestTrackingParametersAreMerged(t *testing.T) {
+	t.Setenv("QR_DEFAULT_UTM", "utm_source=qr&utm_medium=print")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	// the destination's own medium and ref stay, the code's campaign beats the default source
+	w := postQRCode(router, &models.QRCodeRequest{
+		URL:  "https://example.com/page?utm_medium=poster&ref=1#top",
+		Slug: "spring",
+		Tracking: &models.Tracking{
+			UTM:          map[string]string{"utm_campaign": "spring-{id}", "utm_source": "flyer"},
+			ForwardQuery: true,
+		},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	got, err := url.Parse(scanAs(t, router, "spring", ""))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect: %v", err)
+	}
+	want := url.Values{
+		"utm_medium":   {"poster"},
+		"ref":          {"1"},
+		"utm_campaign": {"spring-spring"},
+		"utm_source":   {"flyer"},
+	}
+	if got.Query().Encode() != want.Encode() {
+		t.Errorf("Expected query %s, got %s", want.Encode(), got.RawQuery)
+	}
+	if got.Fragment != "top" || got.Path != "/page" {
+		t.Errorf("Expected the path and fragment to be kept, got %s", got)
+	}
+	if !strings.HasPrefix(got.RawQuery, "utm_medium=poster&ref=1&") {
+		t.Errorf("Expected the existing parameters to keep their order, got %s", got.RawQuery)
+	}
+
+	// forwarded parameters come before templates but never replace the destination's own
+	got, _ = url.Parse(scanAs(t, router, "spring?utm_campaign=door&ref=2&table=7", ""))
+	if q := got.Query(); q.Get("utm_campaign") != "door" || q.Get("ref") != "1" || q.Get("table") != "7" {
+		t.Errorf("Expected forwarded parameters merged under the destination's, got %s", got.RawQuery)
+	}
+}
+
+func TestTrackingWithoutForwarding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: "plain"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scanAs(t, router, "plain?x=y", ""); got != "https://example.com" {
+		t.Errorf("Expected the destination unchanged without tracking, got %s", got)
+	}
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Tracking: &models.Tracking{
+		UTM: map[string]string{"": "empty"},
+	}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty parameter name, got %d", w.Code)
+	}
+}
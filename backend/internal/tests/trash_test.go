@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func TestDeleteMovesToTrash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.GET("/v1/qr/trash", handler.ListTrash)
+	router.GET("/v1/qr/:id", handler.GetQRCode)
+	router.DELETE("/v1/qr/:id", handler.DeleteQRCode)
+	router.POST("/v1/qr/:id/restore", handler.RestoreQRCode)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: "poster"}); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	scanAs(t, router, "poster", "")
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("DELETE", "/v1/qr/poster"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if w := serve("GET", "/r/poster"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a trashed code to redirect as not found, got %d", w.Code)
+	}
+	if w := serve("GET", "/v1/qr/poster"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a trashed code to be not found, got %d", w.Code)
+	}
+	if w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Slug: "poster"}); w.Code != http.StatusConflict {
+		t.Errorf("Expected the slug of a trashed code to stay taken, got %d", w.Code)
+	}
+
+	w := serve("GET", "/v1/qr/trash")
+	var list struct {
+		Trash []models.TrashedQRCode `json:"trash"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Trash) != 1 || list.Trash[0].ID != "poster" {
+		t.Fatalf("Expected the code in the trash, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := list.Trash[0].PurgeAt.Sub(list.Trash[0].DeletedAt); got != 30*24*time.Hour {
+		t.Errorf("Expected the default 30 day retention, got %s", got)
+	}
+
+	w = serve("POST", "/v1/qr/poster/restore")
+	var restored models.QRCodeResponse
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	if w.Code != http.StatusOK || restored.ScanCount != 1 {
+		t.Fatalf("Expected the restored code with its scan, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scanAs(t, router, "poster", ""); got != "https://example.com" {
+		t.Errorf("Expected a restored code to redirect again, got %s", got)
+	}
+	if w := serve("POST", "/v1/qr/poster/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 restoring a code that isn't in the trash, got %d", w.Code)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	t.Setenv("QR_TRASH_RETENTION_DAYS", "7")
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+
+	for _, slug := range []string{"old", "recent", "live"} {
+		if _, err := qrService.GenerateQRCode(&models.QRCodeRequest{URL: "https://example.com", Slug: slug}); err != nil {
+			t.Fatalf("Failed to create %s: %v", slug, err)
+		}
+	}
+	qrService.DeleteQRCode("old")
+	qrService.DeleteQRCode("recent")
+	backdated := time.Now().UTC().Add(-8 * 24 * time.Hour)
+	store.qrCodes["old"].DeletedAt = &backdated
+
+	n, err := qrService.PurgeTrash()
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 code purged, got %d", n)
+	}
+	if _, ok := store.qrCodes["old"]; ok {
+		t.Errorf("Expected the code past the retention to be deleted for good")
+	}
+	if _, err := qrService.RestoreQRCode("recent"); err != nil {
+		t.Errorf("Expected the code within the retention to be restorable, got %v", err)
+	}
+	if _, ok := store.qrCodes["live"]; !ok {
+		t.Errorf("Expected codes outside the trash to be left alone")
+	}
+}
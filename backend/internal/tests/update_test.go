@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+func patchQRCode(router *gin.Engine, id string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("PATCH", "/v1/qr/"+id, bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateQRCodeKeepsImage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+	router.PATCH("/v1/qr/:id", handler.UpdateQRCode)
+	router.GET("/v1/qr/:id/history", handler.GetDestinationHistory)
+	router.GET("/r/:id", handler.HandleRedirect)
+
+	created, _ := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com/old"})
+
+	newURL := "https://example.com/new"
+	expiresIn := int64(3600)
+	w := patchQRCode(router, created.ID, &models.QRCodeUpdate{URL: &newURL, ExpiresInSec: &expiresIn})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var updated models.QRCodeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if updated.URL != newURL {
+		t.Errorf("Expected URL %s, got %s", newURL, updated.URL)
+	}
+	if updated.ImageBase64 != created.ImageBase64 {
+		t.Error("Expected the image to stay the same after changing the destination")
+	}
+	if d := time.Until(updated.ExpiresAt); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("Expected the code to expire in an hour, got %v", d)
+	}
+
+	req, _ := http.NewRequest("GET", "/r/"+created.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != newURL {
+		t.Errorf("Expected a redirect to %s, got %d to %s", newURL, w.Code, w.Header().Get("Location"))
+	}
+
+	// clearing the expiry is a second change, repeating it is not
+	noExpiry := int64(0)
+	for i := 0; i < 2; i++ {
+		if w := patchQRCode(router, created.ID, &models.QRCodeUpdate{ExpiresInSec: &noExpiry}); w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/qr/"+created.ID+"/history", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var response struct {
+		History []models.DestinationChange `json:"history"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.History) != 2 {
+		t.Fatalf("Expected 2 changes, got %d", len(response.History))
+	}
+	first, second := response.History[0], response.History[1]
+	if first.OldURL != "https://example.com/old" || first.NewURL != newURL {
+		t.Errorf("Expected the first change to go from the old to the new URL, got %s to %s", first.OldURL, first.NewURL)
+	}
+	if !first.OldExpiresAt.IsZero() || first.NewExpiresAt.IsZero() {
+		t.Errorf("Expected the first change to set the expiry, got %v to %v", first.OldExpiresAt, first.NewExpiresAt)
+	}
+	if second.OldURL != newURL || second.NewURL != newURL || !second.NewExpiresAt.IsZero() {
+		t.Errorf("Expected the second change to only clear the expiry, got %+v", second)
+	}
+	if first.ChangedAt.IsZero() || second.ChangedAt.Before(first.ChangedAt) {
+		t.Errorf("Expected changes in order with timestamps, got %v and %v", first.ChangedAt, second.ChangedAt)
+	}
+}
+
+func TestUpdateQRCodeWithInvalidRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.PATCH("/v1/qr/:id", handler.UpdateQRCode)
+
+	store.Save(&models.QRCode{ID: "test123", URL: "https://example.com"})
+
+	invalidURL := "not a url"
+	negative := int64(-1)
+	validURL := "https://example.com/new"
+	tests := []struct {
+		name string
+		id   string
+		body *models.QRCodeUpdate
+		code int
+	}{
+		{"invalid url", "test123", &models.QRCodeUpdate{URL: &invalidURL}, http.StatusBadRequest},
+		{"negative expiry", "test123", &models.QRCodeUpdate{ExpiresInSec: &negative}, http.StatusBadRequest},
+		{"nothing to update", "test123", &models.QRCodeUpdate{}, http.StatusBadRequest},
+		{"unknown id", "nonexistent", &models.QRCodeUpdate{URL: &validURL}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := patchQRCode(router, tt.id, tt.body)
+			if w.Code != tt.code {
+				t.Errorf("Expected %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if len(store.history) != 0 {
+		t.Errorf("Expected no changes to be recorded, got %d", len(store.history))
+	}
+}
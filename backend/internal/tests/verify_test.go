@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"encoding/json"
+	"image"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phucnguyen/qrify/internal/handlers"
+	"github.com/phucnguyen/qrify/internal/models"
+	"github.com/phucnguyen/qrify/internal/services"
+)
+
+// a broken frame that cuts off half of the code
+type croppingFrame struct{}
+
+func (croppingFrame) Layout(content image.Point) (image.Point, image.Point) {
+	return content.Div(2), image.Point{}
+}
+
+func (croppingFrame) Shapes(size image.Point, content image.Rectangle, p services.FrameParams) ([]services.Shape, error) {
+	return nil, nil
+}
+
+// a frame that draws nothing and counts the images drawn with it
+type countingFrame struct{}
+
+var countingFrameDraws atomic.Int32
+
+func (countingFrame) Layout(content image.Point) (image.Point, image.Point) {
+	return content, image.Point{}
+}
+
+func (countingFrame) Shapes(size image.Point, content image.Rectangle, p services.FrameParams) ([]services.Shape, error) {
+	countingFrameDraws.Add(1)
+	return nil, nil
+}
+
+func init() {
+	services.RegisterFrame("test-crop", croppingFrame{})
+	services.RegisterFrame("test-count", countingFrame{})
+}
+
+func TestGenerateQRCodeIsVerified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	for _, req := range []*models.QRCodeRequest{
+		{URL: "https://example.com"},
+		{URL: "https://example.com", Format: "svg", ModuleStyle: "dots"},
+		{URL: "https://example.com", Format: "jpeg", Frame: "phone", ForegroundColor: "#2e7d32"},
+	} {
+		response, _ := createAndDecode(t, router, req)
+		if !response.Verified {
+			t.Errorf("Expected the %s code to be verified", response.Format)
+		}
+	}
+}
+
+func TestGenerateQRCodeRejectsUndecodableImage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	w := postQRCode(router, &models.QRCodeRequest{URL: "https://example.com", Frame: "test-crop"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a code that doesn't decode, got %d", w.Code)
+	}
+	if len(store.qrCodes) != 0 {
+		t.Errorf("Expected the code not to be stored")
+	}
+}
+
+func TestGenerateQRCodeWarnsOnUndecodableImage(t *testing.T) {
+	t.Setenv("QR_VERIFY", "warn")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.POST("/v1/qr", handler.CreateQRCode)
+
+	response, _ := createAndDecode(t, router, &models.QRCodeRequest{URL: "https://example.com", Frame: "test-crop"})
+	if response.Verified {
+		t.Errorf("Expected the cropped code not to be verified")
+	}
+}
+
+func TestQRCodeIsVerifiedOnceWithItsStoredOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := NewMockQRCodeStore()
+	qrService := services.NewQRService(store)
+	handler := handlers.NewQRHandler(qrService)
+	router.GET("/v1/qr/:id", handler.GetQRCode)
+	router.GET("/v1/qr/:id/image", handler.GetQRCodeImage)
+
+	store.Save(&models.QRCode{ID: "test123", URL: "https://example.com", Options: models.RenderOptions{Frame: "test-count"}})
+	countingFrameDraws.Store(0)
+
+	// svg used to be verified through an extra png, other sizes aren't verified at all
+	for i := 0; i < 2; i++ {
+		if w := getImage(router, "/v1/qr/test123/image?format=svg&size=300"); w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+	}
+	if n := countingFrameDraws.Load(); n != 1 {
+		t.Errorf("Expected the image endpoint to draw the svg once without verifying it, drew %d images", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		w := getImage(router, "/v1/qr/test123")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		var response models.QRCodeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if !response.Verified {
+			t.Errorf("Expected the code to be verified")
+		}
+	}
+	if n := countingFrameDraws.Load(); n != 2 {
+		t.Errorf("Expected the stored image to be drawn and verified once, drew %d images", n)
+	}
+}
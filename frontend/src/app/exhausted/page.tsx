@@ -0,0 +1,10 @@
+import StatusPage from "@/components/StatusPage";
+
+export default function ExhaustedPage() {
+    return (
+        <StatusPage
+            title="This QR code has been used up"
+            message="This QR code has reached its scan limit and can no longer be used. Contact whoever gave it to you if you think this is a mistake."
+        />
+    );
+}
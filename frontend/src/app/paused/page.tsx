@@ -0,0 +1,10 @@
+import StatusPage from "@/components/StatusPage";
+
+export default function PausedPage() {
+    return (
+        <StatusPage
+            title="This QR code is paused"
+            message="This QR code is not active right now. Please try again later."
+        />
+    );
+}